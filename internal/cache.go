@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// The kinds of entries "goke cache ls" lists: the lock information of a
+// project in the lockfile, and a parser cache file in the user's cache dir.
+const (
+	CacheKindProject = "project"
+	CacheKindParser  = "parser"
+)
+
+// An entry of goke's caches, along with its size in bytes and when it was last used.
+type CacheEntry struct {
+	Kind     string
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// Returns the projects known to the lockfile, sorted by their directory. The size
+// is the one of their lock information. Projects of legacy lockfiles have no last use.
+func (l *Lockfile) CacheEntries() []CacheEntry {
+	entries := []CacheEntry{}
+
+	for dir, project := range l.JSON.Projects {
+		contents, _ := json.Marshal(project)
+		entry := CacheEntry{Kind: CacheKindProject, Path: dir, Size: int64(len(contents))}
+
+		if project.LastUsed != 0 {
+			entry.LastUsed = time.Unix(project.LastUsed, 0)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	return entries
+}
+
+// Returns the parser cache files of all projects. They are touched whenever
+// they're read, so their mtime is when they were last used.
+func ParserCacheEntries(fs FileSystem) ([]CacheEntry, error) {
+	dir, err := parserCacheDir(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fs.Glob(path.Join(dir, parserCachePrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []CacheEntry{}
+	for _, f := range files {
+		fo, err := fs.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, CacheEntry{Kind: CacheKindParser, Path: f, Size: fo.Size(), LastUsed: fo.ModTime()})
+	}
+
+	return entries, nil
+}
+
+// Removes the lock information of all projects.
+func (l *Lockfile) ClearAll() error {
+	return l.update(func() error {
+		for dir := range l.JSON.Projects {
+			delete(l.JSON.Projects, dir)
+		}
+
+		return nil
+	})
+}
+
+// Removes the lock information of the projects whose directory no longer exists,
+// or which weren't used since the given time, along with their parser caches.
+// Returns the directories of the removed projects.
+func (l *Lockfile) Prune(unusedSince time.Time) ([]string, error) {
+	pruned := []string{}
+
+	dir, err := parserCacheDir(l.fs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.update(func() error {
+		for _, entry := range l.CacheEntries() {
+			_, err := l.fs.Stat(entry.Path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			if err == nil && (entry.LastUsed.IsZero() || entry.LastUsed.After(unusedSince)) {
+				continue
+			}
+
+			delete(l.JSON.Projects, entry.Path)
+			pruned = append(pruned, entry.Path)
+
+			parserCaches, err := l.fs.Glob(path.Join(dir, projectParserCachePrefix(entry.Path)+"*"))
+			if err != nil {
+				return err
+			}
+
+			for _, f := range parserCaches {
+				if err := l.fs.Remove(f); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return pruned, err
+}
+
+// Removes the parser cache files which weren't used since the given time. Returns the removed files.
+func PruneParserCaches(fs FileSystem, unusedSince time.Time) ([]string, error) {
+	entries, err := ParserCacheEntries(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []string{}
+	for _, entry := range entries {
+		if entry.LastUsed.After(unusedSince) {
+			continue
+		}
+
+		if err := fs.Remove(entry.Path); err != nil {
+			return nil, err
+		}
+
+		pruned = append(pruned, entry.Path)
+	}
+
+	return pruned, nil
+}
+
+// Writes the cache entries as a table.
+func WriteCacheEntries(out io.Writer, entries []CacheEntry) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tPATH\tSIZE\tLAST USED")
+
+	for _, entry := range entries {
+		lastUsed := "unknown"
+		if !entry.LastUsed.IsZero() {
+			lastUsed = entry.LastUsed.Format("2006-01-02 15:04")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Kind, entry.Path, formatSize(entry.Size), lastUsed)
+	}
+
+	return w.Flush()
+}
+
+// Formats the size in bytes for humans, e.g. "1.5 KB".
+func formatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+}
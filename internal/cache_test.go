@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dugajean/goke/internal/tests"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func cacheLockfile(fsMock *tests.FileSystem) Lockfile {
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.JSON = lockFileJson{Version: LockfileVersion, Projects: map[string]*singleProjectJson{
+		"/code/recent":  {Tasks: map[string]taskLockJson{}, LastUsed: time.Now().Unix()},
+		"/code/old":     {Tasks: map[string]taskLockJson{}, LastUsed: time.Now().AddDate(0, 0, -60).Unix()},
+		"/code/deleted": {Tasks: map[string]taskLockJson{}, LastUsed: time.Now().Unix()},
+		"/code/legacy":  {Tasks: map[string]taskLockJson{}},
+	}}
+
+	return lockfile
+}
+
+func TestCacheEntries(t *testing.T) {
+	lockfile := cacheLockfile(tests.NewFileSystem(t))
+	entries := lockfile.CacheEntries()
+
+	require.Len(t, entries, 4)
+	require.Equal(t, "/code/deleted", entries[0].Path)
+	require.Equal(t, CacheKindProject, entries[0].Kind)
+	require.True(t, entries[1].LastUsed.IsZero())
+	require.Equal(t, int64(len(`{"tasks":{}}`)), entries[1].Size)
+}
+
+func TestPrune(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("Stat", "/code/deleted").Return(tests.MemFileInfo{}, os.ErrNotExist)
+	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{Dir: true}, nil)
+	fsMock.On("UserCacheDir").Return("/home/me/.cache", nil)
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("Glob", "/home/me/.cache/goke/parser/"+projectParserCachePrefix("/code/old")+"*").Return([]string{"/home/me/.cache/goke/parser/old-cache"}, nil)
+	fsMock.On("Glob", mock.Anything).Return([]string{}, nil)
+	fsMock.On("Remove", "/home/me/.cache/goke/parser/old-cache").Return(nil).Once()
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil).Once()
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	lockfile := cacheLockfile(fsMock)
+	pruned, err := lockfile.Prune(time.Now().AddDate(0, 0, -30))
+
+	require.Nil(t, err)
+	require.Equal(t, []string{"/code/deleted", "/code/old"}, pruned)
+	require.Len(t, lockfile.JSON.Projects, 2)
+	require.Contains(t, lockfile.JSON.Projects, "/code/legacy")
+}
+
+func TestPruneParserCaches(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("UserCacheDir").Return("/home/me/.cache", nil)
+	fsMock.On("Glob", "/home/me/.cache/goke/parser/goke-*").Return([]string{"/home/me/.cache/goke/parser/goke-new", "/home/me/.cache/goke/parser/goke-old"}, nil)
+	fsMock.On("Stat", "/home/me/.cache/goke/parser/goke-new").Return(tests.MemFileInfo{Mtime: time.Now()}, nil)
+	fsMock.On("Stat", "/home/me/.cache/goke/parser/goke-old").Return(tests.MemFileInfo{Mtime: time.Now().AddDate(0, 0, -60)}, nil)
+	fsMock.On("Remove", "/home/me/.cache/goke/parser/goke-old").Return(nil).Once()
+
+	pruned, err := PruneParserCaches(fsMock, time.Now().AddDate(0, 0, -30))
+
+	require.Nil(t, err)
+	require.Equal(t, []string{"/home/me/.cache/goke/parser/goke-old"}, pruned)
+}
+
+func TestWriteCacheEntries(t *testing.T) {
+	var out bytes.Buffer
+	lastUsed := time.Date(2022, time.October, 2, 20, 40, 0, 0, time.Local)
+
+	require.Nil(t, WriteCacheEntries(&out, []CacheEntry{
+		{Kind: CacheKindProject, Path: "/code/app", Size: 512, LastUsed: lastUsed},
+		{Kind: CacheKindParser, Path: "/cache/goke-1a2b3c", Size: 3 * 1024},
+	}))
+
+	require.Equal(t, `KIND     PATH                SIZE    LAST USED
+project  /code/app           512 B   2022-10-02 20:40
+parser   /cache/goke-1a2b3c  3.0 KB  unknown
+`, out.String())
+}
@@ -0,0 +1,660 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// NewRootCommand builds the goke command tree.
+// Invoking goke without a subcommand runs the given task, same as "goke run".
+func NewRootCommand() *cobra.Command {
+	var opts Options
+
+	root := &cobra.Command{
+		Use:               "goke [task...] [-- args...]",
+		Short:             "Goke is a build automation tool, similar to Make, but without the Makefile clutter",
+		Version:           CURRENT_VERSION,
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeTasks(&opts),
+		SilenceUsage:      true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return resolveStateDir(&opts)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case opts.Init:
+				return initConfig(&opts)
+			case opts.Tasks || opts.ListJSON:
+				opts.JSON = opts.JSON || opts.ListJSON
+				return listTasks(cmd, &opts)
+			}
+
+			return runTasks(cmd, &opts, args)
+		},
+	}
+
+	root.SetVersionTemplate("{{.Version}}\n")
+	root.PersistentFlags().BoolVarP(&opts.NoCache, "no-cache", "c", false, "Clears the program's cache")
+	root.PersistentFlags().BoolVarP(&opts.Quiet, "quiet", "q", false, "Suppresses all output from tasks")
+	root.PersistentFlags().BoolVar(&opts.Verbose, "verbose", false, "Explains why tasks run, e.g. which of their files changed")
+	addRunFlags(root, &opts)
+
+	// Flags kept around from before goke had subcommands.
+	root.Flags().BoolVarP(&opts.Init, "init", "i", false, "Creates a goke.yml file in the current directory")
+	root.Flags().BoolVarP(&opts.Tasks, "tasks", "t", false, "Outputs a list of all task names")
+	root.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Outputs the task list as JSON, used with --tasks")
+	root.Flags().BoolVar(&opts.ListJSON, "list-json", false, "Shorthand for --tasks --json")
+	_ = root.Flags().MarkDeprecated("init", "use \"goke init\" instead")
+	_ = root.Flags().MarkDeprecated("tasks", "use \"goke list\" instead")
+	_ = root.Flags().MarkDeprecated("json", "use \"goke list --json\" instead")
+	_ = root.Flags().MarkDeprecated("list-json", "use \"goke list --json\" instead")
+
+	root.AddCommand(
+		newRunCommand(&opts),
+		newListCommand(&opts),
+		newInitCommand(&opts),
+		newCleanCommand(&opts),
+		newGraphCommand(&opts),
+		newValidateCommand(&opts),
+		newStatusCommand(&opts),
+		newWhyCommand(&opts),
+		newHashCommand(&opts),
+		newTouchCommand(&opts),
+		newInvalidateCommand(&opts),
+		newCacheCommand(&opts),
+	)
+
+	return root
+}
+
+// Returns the names and aliases of goke's subcommands, including the ones cobra adds.
+// Tasks with these names can only be run with "goke run <task>".
+func subcommandNames() []string {
+	root := NewRootCommand()
+	root.InitDefaultHelpCmd()
+	root.InitDefaultCompletionCmd()
+
+	names := []string{}
+	for _, cmd := range root.Commands() {
+		names = append(names, cmd.Name())
+		names = append(names, cmd.Aliases...)
+	}
+
+	return names
+}
+
+func newRunCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "run [task...] [-- args...]",
+		Short:             "Runs the given tasks, or the main task if omitted",
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeTasks(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTasks(cmd, opts, args)
+		},
+	}
+
+	addRunFlags(cmd, opts)
+	return cmd
+}
+
+func newListCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Outputs a list of all task names",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listTasks(cmd, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Outputs the task list as JSON")
+	return cmd
+}
+
+func newInitCommand(opts *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Creates a goke.yml file in the current directory",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return initConfig(opts)
+		},
+	}
+}
+
+func newCleanCommand(opts *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "clean",
+		Short: "Clears the parser cache and the lock information of the current project",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return clearProjectCache(opts)
+		},
+	}
+}
+
+func newCacheCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the lock information and the parser caches of all projects",
+	}
+
+	var project bool
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Clears the caches of all projects, or only of the current one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if project {
+				return clearProjectCache(opts)
+			}
+
+			fs := LocalFileSystem{}
+			parserCaches, err := ParserCacheEntries(&fs)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range parserCaches {
+				if err := fs.Remove(entry.Path); err != nil {
+					return err
+				}
+			}
+
+			l := NewLockfile(opts, &fs)
+			l.Bootstrap()
+
+			return l.ClearAll()
+		},
+	}
+	clearCmd.Flags().BoolVar(&project, "project", false, "Only clears the caches of the current project")
+
+	var days int
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Removes the caches of projects which no longer exist or weren't used recently",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fs := LocalFileSystem{}
+			unusedSince := time.Now().AddDate(0, 0, -days)
+
+			l := NewLockfile(opts, &fs)
+			l.Bootstrap()
+
+			projects, err := l.Prune(unusedSince)
+			if err != nil {
+				return err
+			}
+
+			parserCaches, err := PruneParserCaches(&fs, unusedSince)
+			if err != nil {
+				return err
+			}
+
+			for _, removed := range append(projects, parserCaches...) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed %s\n", removed)
+			}
+
+			return nil
+		},
+	}
+	pruneCmd.Flags().IntVar(&days, "days", 30, "Removes the caches which weren't used for this many days")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "ls",
+			Short: "Lists the cached projects and parser caches, with their size and last use",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				fs := LocalFileSystem{}
+				l := NewLockfile(opts, &fs)
+				l.Bootstrap()
+
+				parserCaches, err := ParserCacheEntries(&fs)
+				if err != nil {
+					return err
+				}
+
+				return WriteCacheEntries(cmd.OutOrStdout(), append(l.CacheEntries(), parserCaches...))
+			},
+		},
+		clearCmd,
+		pruneCmd,
+	)
+
+	return cmd
+}
+
+// Sets the state directory configured for the project, if any. Commands which
+// don't need a configuration run without one, using the default directory.
+func resolveStateDir(opts *Options) error {
+	cfg, _ := ReadYamlConfig()
+
+	dir, err := ConfiguredStateDir(cfg, &LocalFileSystem{})
+	if err != nil {
+		return err
+	}
+
+	opts.StateDir = dir
+	return nil
+}
+
+// Clears the parser cache and the lock information of the current project.
+func clearProjectCache(opts *Options) error {
+	fs := LocalFileSystem{}
+	if err := ClearParserCache(&fs); err != nil {
+		return err
+	}
+
+	l := NewLockfile(opts, &fs)
+	l.Bootstrap()
+
+	return l.ClearCurrentProject()
+}
+
+func newGraphCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "graph [task...]",
+		Short:             "Outputs the tree of tasks invoked by the given tasks, or by all tasks",
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeTasks(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := bootstrapParser(opts, &LocalFileSystem{})
+			if err != nil {
+				return err
+			}
+
+			for _, taskName := range args {
+				if _, ok := p.GetTask(taskName); !ok {
+					return fmt.Errorf("task '%s' not found", taskName)
+				}
+			}
+
+			return WriteTaskGraph(cmd.OutOrStdout(), p, args, opts.Dot)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Dot, "dot", false, "Outputs the graph in Graphviz DOT format")
+	return cmd
+}
+
+func newValidateCommand(opts *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Checks the goke.yml file for mistakes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := ReadYamlConfig()
+			if err != nil {
+				return err
+			}
+
+			problems := ValidateConfig(cfg)
+			if len(problems) == 0 {
+				p, err := bootstrapParser(opts, &LocalFileSystem{})
+				if err != nil {
+					return err
+				}
+
+				problems = FindTaskCycles(p)
+			}
+
+			for _, problem := range problems {
+				fmt.Fprintln(cmd.OutOrStdout(), problem)
+			}
+
+			if len(problems) > 0 {
+				return fmt.Errorf("%s has %d problem(s)", CurrentConfigFile(), len(problems))
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", CurrentConfigFile())
+			return nil
+		},
+	}
+}
+
+func newStatusCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Outputs whether every task is up-to-date or stale",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, e, err := bootstrapExecutor(opts)
+			if err != nil {
+				return err
+			}
+
+			return e.WriteStatus(cmd.OutOrStdout(), p.GetTasks())
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Shows the state as if the tasks were run with --force")
+	return cmd
+}
+
+func newWhyCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "why <task>",
+		Short:             "Explains why the task would run, or why it is up-to-date",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeTasks(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, e, err := bootstrapExecutor(opts)
+			if err != nil {
+				return err
+			}
+
+			task, ok := p.GetTask(args[0])
+			if !ok {
+				return fmt.Errorf("task '%s' not found", args[0])
+			}
+
+			return e.WriteWhy(cmd.OutOrStdout(), task)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Explains the task as if it was run with --force")
+	return cmd
+}
+
+func newHashCommand(opts *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "hash <task>",
+		Short:             "Outputs a fingerprint of the inputs of the task and the tasks it invokes",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeTasks(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, e, err := bootstrapExecutor(opts)
+			if err != nil {
+				return err
+			}
+
+			task, ok := p.GetTask(args[0])
+			if !ok {
+				return fmt.Errorf("task '%s' not found", args[0])
+			}
+
+			hash, err := e.TaskHash(task)
+			if err != nil {
+				return err
+			}
+
+			if !opts.JSON {
+				fmt.Fprintln(cmd.OutOrStdout(), hash.Hash)
+				return nil
+			}
+
+			out, err := hash.JSON()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), out)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Outputs the hash as JSON, along with the hash of every file")
+	return cmd
+}
+
+func newTouchCommand(opts *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "touch <task...>",
+		Short:             "Marks the tasks as up-to-date without running them",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeTasks(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, e, err := bootstrapExecutor(opts)
+			if err != nil {
+				return err
+			}
+
+			for _, taskName := range args {
+				task, ok := p.GetTask(taskName)
+				if !ok {
+					return fmt.Errorf("task '%s' not found", taskName)
+				}
+
+				if err := e.Touch(task); err != nil {
+					return err
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "Marked '%s' as up-to-date\n", taskName)
+			}
+
+			return nil
+		},
+	}
+}
+
+func newInvalidateCommand(opts *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "invalidate <task...>",
+		Short:             "Marks the tasks as stale, so that they run the next time",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeTasks(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := bootstrapParser(opts, &LocalFileSystem{})
+			if err != nil {
+				return err
+			}
+
+			l := NewLockfile(opts, &LocalFileSystem{})
+			l.Bootstrap()
+
+			for _, taskName := range args {
+				if _, ok := p.GetTask(taskName); !ok {
+					return fmt.Errorf("task '%s' not found", taskName)
+				}
+
+				invalidated, err := l.InvalidateTask(taskName)
+				if err != nil {
+					return err
+				}
+
+				if invalidated {
+					fmt.Fprintf(cmd.OutOrStdout(), "Marked '%s' as stale\n", taskName)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "Nothing was recorded for '%s'\n", taskName)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// Registers the flags which control how tasks are run.
+func addRunFlags(cmd *cobra.Command, opts *Options) {
+	cmd.Flags().BoolVarP(&opts.Watch, "watch", "w", false, "Run task in watch mode")
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Runs the task even if files have not been changed")
+	cmd.Flags().BoolVar(&opts.Check, "check", false, "Fails if any of the tasks is stale, without running anything")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Confirms the prompts of all tasks")
+	cmd.Flags().BoolVarP(&opts.Continue, "continue", "k", false, "Keeps running the remaining tasks after a task fails")
+	cmd.Flags().IntVar(&opts.FailureExitCode, "failure-exit-code", 0, "The exit code to use when a command fails, instead of the command's own")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputAuto, "How to display the run: "+strings.Join(OutputModes, ", "))
+	cmd.Flags().BoolVar(&opts.Timings, "timings", false, "Outputs how long every command took after the run")
+	cmd.Flags().StringVar(&opts.LogFormat, "log-format", LogFormatText, "The format of the run log: text, or json for one event per line")
+	cmd.Flags().StringVar(&opts.LogFile, "log-file", "", "Writes the JSON event log to the given file instead of stdout")
+	cmd.Flags().StringArrayVarP(&opts.Args, "args", "a", nil, "The arguments and options to pass to the underlying commands")
+	_ = cmd.Flags().MarkDeprecated("args", "pass the arguments after \"--\" instead")
+}
+
+// Splits the positional arguments into task names and
+// the arguments which were given after "--".
+func splitPassthroughArgs(cmd *cobra.Command, args []string) ([]string, []string) {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		return args[:dash], args[dash:]
+	}
+
+	return args, nil
+}
+
+// Completes the names of the tasks which weren't given yet,
+// including their descriptions when the shell supports it.
+func completeTasks(opts *Options) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		p, err := bootstrapParser(opts, &LocalFileSystem{})
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		given := make(map[string]bool)
+		for _, arg := range args {
+			given[arg] = true
+		}
+
+		var names []string
+		for _, task := range p.GetTasks() {
+			if given[task.Name] {
+				continue
+			}
+
+			if task.Desc != "" {
+				names = append(names, task.Name+"\t"+task.Desc)
+			} else {
+				names = append(names, task.Name)
+			}
+		}
+
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// Reads the configuration file and returns a bootstrapped parser for it.
+func bootstrapParser(opts *Options, fs FileSystem) (Parseable, error) {
+	cfg, err := ReadYamlConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewParser(cfg, opts, fs)
+	p.Bootstrap()
+
+	return p, nil
+}
+
+// Returns a bootstrapped parser, and an executor for inspecting its tasks without running them.
+func bootstrapExecutor(opts *Options) (Parseable, *Executor, error) {
+	fs := LocalFileSystem{}
+	proc := ShellProcess{}
+
+	p, err := bootstrapParser(opts, &fs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := NewLockfile(opts, &fs)
+	l.Bootstrap()
+
+	ctx := context.Background()
+	e := NewExecutor(&p, &l, opts, &proc, &fs, &ctx)
+
+	return p, &e, nil
+}
+
+// Runs the tasks given in the arguments. Anything after "--" is
+// passed to the main commands of the requested tasks.
+func runTasks(cmd *cobra.Command, opts *Options, args []string) error {
+	tasks, passthrough := splitPassthroughArgs(cmd, args)
+	opts.TaskNames = tasks
+	opts.Args = append(opts.Args, passthrough...)
+
+	if err := ValidateOutputMode(opts.Output); err != nil {
+		return err
+	}
+
+	if err := ValidateLogFormat(opts.LogFormat); err != nil {
+		return err
+	}
+
+	if opts.LogFile != "" {
+		opts.LogFormat = LogFormatJSON
+	}
+
+	if opts.Check && opts.Watch {
+		return fmt.Errorf("--check can't be combined with --watch")
+	}
+
+	fs := LocalFileSystem{}
+	proc := ShellProcess{}
+
+	p, err := bootstrapParser(opts, &fs)
+	if err != nil {
+		return err
+	}
+
+	l := NewLockfile(opts, &fs)
+	l.Bootstrap()
+
+	if err := l.MarkUsed(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	e := NewExecutor(&p, &l, opts, &proc, &fs, &ctx)
+
+	if opts.LogFormat == LogFormatJSON {
+		log := cmd.OutOrStdout()
+		if opts.LogFile != "" {
+			f, err := os.Create(opts.LogFile)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+			log = f
+		}
+
+		e.AddListener(NewJSONEventLogger(log))
+	}
+
+	e.Start(opts.TaskNames)
+
+	return nil
+}
+
+// Outputs the names of all tasks, or the JSON listing if requested.
+func listTasks(cmd *cobra.Command, opts *Options) error {
+	p, err := bootstrapParser(opts, &LocalFileSystem{})
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		listing, err := NewTaskListing(p)
+		if err != nil {
+			return err
+		}
+
+		out, err := listing.JSON()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), out)
+		return nil
+	}
+
+	for _, task := range p.GetTasks() {
+		fmt.Fprintln(cmd.OutOrStdout(), task.Name)
+	}
+
+	return nil
+}
+
+// Creates goke.yml if it doesn't exist.
+func initConfig(opts *Options) error {
+	if err := CreateGokeConfig(); err != nil && !opts.Quiet {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootCommandTree(t *testing.T) {
+	root := NewRootCommand()
+
+	for _, name := range []string{"run", "list", "init", "clean", "graph", "validate", "status", "why", "hash", "touch", "invalidate", "cache"} {
+		cmd, _, err := root.Find([]string{name})
+		require.Nil(t, err)
+		require.Equal(t, name, cmd.Name())
+	}
+}
+
+func TestSplitPassthroughArgs(t *testing.T) {
+	root := NewRootCommand()
+	require.Nil(t, root.ParseFlags([]string{"test", "--", "-run", "TestX"}))
+
+	tasks, passthrough := splitPassthroughArgs(root, root.Flags().Args())
+
+	require.Equal(t, []string{"test"}, tasks)
+	require.Equal(t, []string{"-run", "TestX"}, passthrough)
+}
+
+func TestSplitPassthroughArgsWithoutDash(t *testing.T) {
+	root := NewRootCommand()
+	require.Nil(t, root.ParseFlags([]string{"test"}))
+
+	tasks, passthrough := splitPassthroughArgs(root, root.Flags().Args())
+
+	require.Equal(t, []string{"test"}, tasks)
+	require.Nil(t, passthrough)
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dugajean/goke/internal/cli"
+)
+
+// The environment variables goke sets for every command it runs.
+const (
+	EnvTask         = "GOKE_TASK"
+	EnvRootTask     = "GOKE_ROOT_TASK"
+	EnvConfigDir    = "GOKE_CONFIG_DIR"
+	EnvChangedFiles = "GOKE_CHANGED_FILES"
+	EnvArgs         = "GOKE_ARGS"
+	EnvAttempt      = "GOKE_ATTEMPT"
+
+	// Only set for the commands of hooks.
+	EnvLastExitCode  = "GOKE_LAST_EXIT_CODE"
+	EnvFailedCommand = "GOKE_FAILED_COMMAND"
+)
+
+var runEnvNames = []string{
+	EnvTask, EnvRootTask, EnvConfigDir, EnvChangedFiles, EnvArgs, EnvAttempt, EnvLastExitCode, EnvFailedCommand,
+}
+
+// Stands in for a GOKE_* variable while the command line is split.
+const runEnvPlaceholder = "\x00"
+
+// Sets the GOKE_* variables describing the command which is about to run on
+// behalf of the task. Commands inherit the environment of goke, and can use
+// the variables in their command line as well, see splitCommandLine.
+func (e *Executor) setRunEnv(task Task) error {
+	configDir, err := e.fs.Getwd()
+	if err != nil {
+		return err
+	}
+
+	changed, err := e.changedFilesForRun(task)
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{
+		EnvTask:         task.Name,
+		EnvRootTask:     e.rootTask,
+		EnvConfigDir:    configDir,
+		EnvChangedFiles: strings.Join(changed, " "),
+		EnvArgs:         JoinInnerArgs(e.options.Args),
+		// Commands aren't retried, so there is only ever one attempt.
+		EnvAttempt: "1",
+	}
+
+	for k, v := range vars {
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+
+	if e.hookDepth == 0 {
+		_ = os.Unsetenv(EnvLastExitCode)
+		_ = os.Unsetenv(EnvFailedCommand)
+		return nil
+	}
+
+	failedCommand := ""
+	var cmdErr *CommandError
+	if errors.As(e.lastErr, &cmdErr) {
+		failedCommand = cmdErr.Command
+	}
+
+	if err := os.Setenv(EnvLastExitCode, strconv.Itoa(exitCode(e.lastErr))); err != nil {
+		return err
+	}
+
+	return os.Setenv(EnvFailedCommand, failedCommand)
+}
+
+// Expands the environment variables in the command line and splits it into arguments.
+// The GOKE_* variables are expanded only after splitting, so that their values, e.g. a
+// failed command with quotes in it, always end up within the argument they're used in.
+func splitCommandLine(c string) ([]string, error) {
+	expanded := os.Expand(c, func(name string) string {
+		if isRunEnv(name) {
+			return runEnvPlaceholder + name + runEnvPlaceholder
+		}
+
+		return os.Getenv(name)
+	})
+
+	args, err := cli.ParseCommandLine(expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	split := []string{}
+	for _, arg := range args {
+		placeholders := strings.Contains(arg, runEnvPlaceholder)
+		for _, name := range runEnvNames {
+			arg = strings.Replace(arg, runEnvPlaceholder+name+runEnvPlaceholder, os.Getenv(name), -1)
+		}
+
+		// Like before splitting, an argument of only empty variables is left out.
+		if placeholders && arg == "" {
+			continue
+		}
+
+		split = append(split, arg)
+	}
+
+	return split, nil
+}
+
+// Whether the variable is one of the GOKE_* variables set for every command.
+func isRunEnv(name string) bool {
+	for _, n := range runEnvNames {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
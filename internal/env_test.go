@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const envConfig = `
+lint:
+  run:
+    - "echo lint"
+
+build:
+  files: [cmd/cli/*]
+  events:
+    on_failure:
+      - "echo notify"
+  run:
+    - "lint"
+    - "go build"
+`
+
+func TestStartSetsRunEnv(t *testing.T) {
+	// Restores the variables once the test is done.
+	for _, name := range []string{EnvTask, EnvRootTask, EnvConfigDir, EnvChangedFiles, EnvArgs, EnvAttempt, EnvLastExitCode, EnvFailedCommand} {
+		t.Setenv(name, "")
+	}
+
+	envOpts := Options{NoCache: true, Force: true, Output: OutputPlain, Args: []string{"-v"}}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &envOpts, envConfig)
+
+	envs := map[string]map[string]string{}
+	capture := func(args mock.Arguments) {
+		env := map[string]string{}
+		for _, name := range []string{EnvTask, EnvRootTask, EnvConfigDir, EnvChangedFiles, EnvArgs, EnvAttempt} {
+			env[name] = os.Getenv(name)
+		}
+
+		if code, ok := os.LookupEnv(EnvLastExitCode); ok {
+			env[EnvLastExitCode] = code
+			env[EnvFailedCommand] = os.Getenv(EnvFailedCommand)
+		}
+
+		envs[args.String(1)] = env
+	}
+
+	process.On("Execute", "echo", "lint").Run(capture).Return([]byte("lint"), nil, nil).Once()
+	process.On("Execute", "go", "build", "-v").Run(capture).Return(nil, nil, exitError(t, 2, "boom")).Once()
+	process.On("Execute", "echo", "notify").Run(capture).Return([]byte("notify"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 2).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &envOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	require.Equal(t, map[string]string{
+		EnvTask:         "lint",
+		EnvRootTask:     "build",
+		EnvConfigDir:    "path/to/cwd",
+		EnvChangedFiles: "",
+		EnvArgs:         "-v",
+		EnvAttempt:      "1",
+	}, envs["lint"])
+
+	require.Equal(t, "build", envs["build"][EnvTask])
+	require.NotContains(t, envs["build"], EnvLastExitCode)
+
+	require.Equal(t, "build", envs["notify"][EnvTask])
+	require.Equal(t, "2", envs["notify"][EnvLastExitCode])
+	require.Equal(t, "go build -v", envs["notify"][EnvFailedCommand])
+}
+
+const quotedFailureConfig = `
+build:
+  events:
+    on_failure:
+      - "echo \"failed: $GOKE_FAILED_COMMAND\" $GOKE_CHANGED_FILES"
+  run:
+    - "go build -ldflags \"-X main.version=1.0\""
+`
+
+func TestStartKeepsRunEnvInOneArgument(t *testing.T) {
+	for _, name := range []string{EnvLastExitCode, EnvFailedCommand} {
+		t.Setenv(name, "")
+	}
+
+	envOpts := Options{NoCache: true, Force: true, Output: OutputPlain}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &envOpts, quotedFailureConfig)
+
+	process.On("Execute", "go", "build", "-ldflags", "-X main.version=1.0").Return(nil, nil, exitError(t, 2, "boom")).Once()
+	process.On("Execute", "echo", `failed: go build -ldflags "-X main.version=1.0"`).Return([]byte("notified"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 2).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &envOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+}
+
+const continueConfig = `
+f:
+  run:
+    - "false"
+
+g:
+  events:
+    before_each_task:
+      - "echo hook"
+  run:
+    - "echo g"
+`
+
+func TestStartResetsLastExitCodeForEveryTask(t *testing.T) {
+	for _, name := range []string{EnvLastExitCode, EnvFailedCommand} {
+		t.Setenv(name, "")
+	}
+
+	envOpts := Options{NoCache: true, Force: true, Continue: true, Output: OutputPlain}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &envOpts, continueConfig)
+
+	hookEnv := map[string]string{}
+	process.On("Execute", "false").Return(nil, nil, exitError(t, 1, "")).Once()
+	process.On("Execute", "echo", "hook").Run(func(args mock.Arguments) {
+		hookEnv[EnvLastExitCode] = os.Getenv(EnvLastExitCode)
+		hookEnv[EnvFailedCommand] = os.Getenv(EnvFailedCommand)
+	}).Return([]byte("hook"), nil, nil).Once()
+	process.On("Execute", "echo", "g").Return([]byte("g"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", mock.Anything).Return().Maybe()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &envOpts, process, fsMock, &ctx)
+	executor.Start([]string{"f", "g"})
+
+	require.Equal(t, map[string]string{EnvLastExitCode: "0", EnvFailedCommand: ""}, hookEnv)
+}
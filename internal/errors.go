@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The exit code goke uses when it fails for any reason other than a failing
+// command, e.g. a broken goke.yml or an unknown task. Commands rarely exit
+// with it, so CI can tell these failures apart from failing tasks.
+const ExitInfraError = 125
+
+// The exit code of --check when any of the tasks is stale.
+const ExitStale = 1
+
+// How many lines from the end of stderr a CommandError keeps.
+const stderrTailLines = 20
+
+// CommandError is returned when a command of a task exits with a non-zero code.
+type CommandError struct {
+	Task     string
+	Command  string
+	ExitCode int
+	Stderr   string
+	err      error
+}
+
+// Wraps the error of a command which exited unsuccessfully. Other errors,
+// e.g. a command which could not be started, are returned unchanged.
+func newCommandError(task string, command string, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	return &CommandError{
+		Task:     task,
+		Command:  command,
+		ExitCode: exitErr.ExitCode(),
+		Stderr:   tailLines(string(exitErr.Stderr), stderrTailLines),
+		err:      err,
+	}
+}
+
+func (ce *CommandError) Error() string {
+	return fmt.Sprintf("command '%s' of task '%s' exited with code %d", ce.Command, ce.Task, ce.ExitCode)
+}
+
+func (ce *CommandError) Unwrap() error {
+	return ce.err
+}
+
+// The failures collected when --continue is given.
+type taskFailures struct {
+	tasks []string
+	errs  []error
+}
+
+func (tf *taskFailures) add(task string, err error) {
+	tf.tasks = append(tf.tasks, task)
+	tf.errs = append(tf.errs, err)
+}
+
+func (tf *taskFailures) Error() string {
+	lines := make([]string, len(tf.errs))
+	for i, err := range tf.errs {
+		lines[i] = fmt.Sprintf("%s: %s", tf.tasks[i], err)
+	}
+
+	return fmt.Sprintf("%d task(s) failed\n%s", len(tf.errs), strings.Join(lines, "\n"))
+}
+
+// The first failure decides the exit code.
+func (tf *taskFailures) Unwrap() error {
+	return tf.errs[0]
+}
+
+// Returns the command errors the error consists of.
+func commandErrors(err error) []*CommandError {
+	var failures *taskFailures
+	if errors.As(err, &failures) {
+		var all []*CommandError
+		for _, e := range failures.errs {
+			all = append(all, commandErrors(e)...)
+		}
+
+		return all
+	}
+
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return []*CommandError{cmdErr}
+	}
+
+	return nil
+}
+
+// Formats the error for the user, followed by the stderr of every failed command.
+func formatError(err error) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Error: %s\n", err))
+
+	for _, cmdErr := range commandErrors(err) {
+		if cmdErr.Stderr == "" {
+			continue
+		}
+
+		b.WriteString(fmt.Sprintf("\nstderr of '%s':\n", cmdErr.Command))
+		for _, line := range strings.Split(strings.TrimRight(cmdErr.Stderr, "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// Returns the last n lines of the text.
+func tailLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) <= n {
+		return text
+	}
+
+	return strings.Join(lines[len(lines)-n:], "\n") + "\n"
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCommandError(t *testing.T) {
+	err := newCommandError("test", "go test ./...", exitError(t, 2, "--- FAIL: TestFoo"))
+
+	var cmdErr *CommandError
+	require.True(t, errors.As(err, &cmdErr))
+	require.Equal(t, "test", cmdErr.Task)
+	require.Equal(t, 2, cmdErr.ExitCode)
+	require.Equal(t, "--- FAIL: TestFoo\n", cmdErr.Stderr)
+	require.Equal(t, "command 'go test ./...' of task 'test' exited with code 2", err.Error())
+	require.Equal(t, 2, exitCode(err))
+}
+
+func TestNewCommandErrorKeepsOtherErrors(t *testing.T) {
+	original := errors.New("executable file not found")
+	require.Equal(t, original, newCommandError("test", "go test ./...", original))
+}
+
+func TestFormatError(t *testing.T) {
+	failures := &taskFailures{}
+	failures.add("lint", newCommandError("lint", "go vet ./...", exitError(t, 1, "vet: bad")))
+	failures.add("test", newCommandError("test", "go test ./...", exitError(t, 2, "FAIL")))
+
+	want := `Error: 2 task(s) failed
+lint: command 'go vet ./...' of task 'lint' exited with code 1
+test: command 'go test ./...' of task 'test' exited with code 2
+
+stderr of 'go vet ./...':
+  vet: bad
+
+stderr of 'go test ./...':
+  FAIL
+`
+	require.Equal(t, want, formatError(failures))
+	require.Equal(t, 1, exitCode(failures))
+}
+
+func TestTailLines(t *testing.T) {
+	lines := []string{}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+
+	tail := tailLines(strings.Join(lines, "\n")+"\n", 3)
+	require.Equal(t, strings.Join(lines[27:], "\n")+"\n", tail)
+	require.Equal(t, "a\nb\n", tailLines("a\nb\n", 3))
+}
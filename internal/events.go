@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// The available formats of the event log, selected via --log-format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// The version of the event schema. Bump it whenever a field
+// is renamed or removed, adding fields is backwards compatible.
+const EventSchemaVersion = 1
+
+type EventType string
+
+const (
+	EventRunStarted     EventType = "run_started"
+	EventRunFinished    EventType = "run_finished"
+	EventTaskStarted    EventType = "task_started"
+	EventTaskFinished   EventType = "task_finished"
+	EventTaskSkipped    EventType = "task_skipped"
+	EventHookStarted    EventType = "hook_started"
+	EventHookFinished   EventType = "hook_finished"
+	EventCommandStarted EventType = "command_started"
+	// The whole output of a command, sent once it exited, as the output is buffered.
+	EventCommandOutput   EventType = "output"
+	EventCommandFinished EventType = "command_finished"
+	EventMessage         EventType = "message"
+	EventPrompt          EventType = "prompt"
+	EventPromptAnswered  EventType = "prompt_answered"
+)
+
+// The reasons for which a task gets skipped.
+const (
+	SkipUpToDate   = "up-to-date"
+	SkipAlreadyRan = "already-ran"
+)
+
+// The streams command output can come from.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Event describes a single thing that happened during a run.
+// Only the fields relevant to the event type are set.
+type Event struct {
+	Version     int       `json:"v"`
+	Type        EventType `json:"type"`
+	Time        time.Time `json:"time"`
+	Tasks       []string  `json:"tasks,omitempty"`
+	Task        string    `json:"task,omitempty"`
+	Hook        string    `json:"hook,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	Interactive bool      `json:"interactive,omitempty"`
+	Stream      string    `json:"stream,omitempty"`
+	Data        string    `json:"data,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Confirmed   *bool     `json:"confirmed,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ExitCode    *int      `json:"exit_code,omitempty"`
+	DurationMs  *float64  `json:"duration_ms,omitempty"`
+}
+
+// EventListener receives every event emitted by the executor.
+// Renderers, the run report and the JSON log are all built on it.
+type EventListener interface {
+	Handle(event Event)
+}
+
+// Returns a copy of the event carrying the outcome of something that took the given duration.
+func (ev Event) withResult(duration time.Duration, err error) Event {
+	code := exitCode(err)
+	ms := float64(duration) / float64(time.Millisecond)
+
+	ev.ExitCode = &code
+	ev.DurationMs = &ms
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	return ev
+}
+
+// Returns the duration carried by the event, if any.
+func (ev Event) duration() time.Duration {
+	if ev.DurationMs == nil {
+		return 0
+	}
+
+	return time.Duration(*ev.DurationMs * float64(time.Millisecond))
+}
+
+// ValidateLogFormat returns an error if the log format is unknown.
+func ValidateLogFormat(format string) error {
+	if format == "" || format == LogFormatText || format == LogFormatJSON {
+		return nil
+	}
+
+	return fmt.Errorf("unknown log format '%s', must be one of: %s, %s", format, LogFormatText, LogFormatJSON)
+}
+
+// Returns whatever the failed command wrote to stderr.
+func commandStderr(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(exitErr.Stderr)
+	}
+
+	return ""
+}
+
+// Writes every event as a line of JSON (NDJSON).
+type jsonEventLogger struct {
+	encoder *json.Encoder
+}
+
+// NewJSONEventLogger creates a listener which writes the events to w, one JSON object per line.
+func NewJSONEventLogger(w io.Writer) EventListener {
+	return &jsonEventLogger{encoder: json.NewEncoder(w)}
+}
+
+func (l *jsonEventLogger) Handle(event Event) {
+	_ = l.encoder.Encode(event)
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONEventLogger(t *testing.T) {
+	var out strings.Builder
+	logger := NewJSONEventLogger(&out)
+
+	logger.Handle(Event{Version: EventSchemaVersion, Type: EventTaskStarted, Task: "build"})
+	logger.Handle(Event{Version: EventSchemaVersion, Type: EventTaskFinished, Task: "build"}.withResult(1500*time.Microsecond, errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, `{"v":1,"type":"task_started","time":"0001-01-01T00:00:00Z","task":"build"}`, lines[0])
+	require.Equal(t, `{"v":1,"type":"task_finished","time":"0001-01-01T00:00:00Z","task":"build","error":"boom","exit_code":1,"duration_ms":1.5}`, lines[1])
+}
+
+func TestEventWithResult(t *testing.T) {
+	ev := Event{Type: EventCommandFinished}.withResult(2*time.Second, nil)
+
+	require.Equal(t, 0, *ev.ExitCode)
+	require.Empty(t, ev.Error)
+	require.Equal(t, 2*time.Second, ev.duration())
+	require.Equal(t, time.Duration(0), Event{}.duration())
+}
+
+func TestValidateLogFormat(t *testing.T) {
+	require.Nil(t, ValidateLogFormat(""))
+	require.Nil(t, ValidateLogFormat(LogFormatJSON))
+	require.NotNil(t, ValidateLogFormat("xml"))
+}
@@ -5,102 +5,128 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
-
-	"github.com/dugajean/goke/internal/cli"
-	"github.com/theckman/yacspin"
 )
 
 // This represent the default task, so when the user
 // doesn't provide any args to the program, we default to this.
 const DefaultTask = "main"
 
-var spinnerCfg = yacspin.Config{
-	Frequency:         100 * time.Millisecond,
-	Colors:            []string{"fgYellow"},
-	CharSet:           yacspin.CharSets[11],
-	Suffix:            " ",
-	SuffixAutoColon:   true,
-	Message:           "Running commands",
-	StopCharacter:     "✓",
-	StopColors:        []string{"fgGreen"},
-	StopMessage:       "Done",
-	StopFailCharacter: "✗",
-	StopFailColors:    []string{"fgRed"},
-	StopFailMessage:   "Failed",
-}
-
 type Executor struct {
-	parser   Parseable
-	lockfile Lockfile
-	spinner  *yacspin.Spinner
-	options  Options
-	process  Process
-	fs       FileSystem
-	context  context.Context
+	parser    Parseable
+	lockfile  Lockfile
+	listeners []EventListener
+	options   Options
+	process   Process
+	fs        FileSystem
+	context   context.Context
+
+	// How many hooks are running, global hooks never run for tasks invoked by hooks.
+	hookDepth int
+
+	// The tasks with their files as matched in this invocation, by task name.
+	expanded map[string]Task
+
+	// How the inputs of the tasks checked in this invocation changed, by task name.
+	staleness map[string]Staleness
+
+	// The inputs of the tasks which failed while watching, by task name.
+	failed map[string]Staleness
+
+	// The requested task which is being run, and the error of the last command it ran.
+	rootTask string
+	lastErr  error
+
+	// Results of the tasks that already ran in this invocation, by task name.
+	dispatched map[string]error
+	report     *RunReport
 }
 
 // Executor constructor.
 func NewExecutor(p *Parseable, l *Lockfile, opts *Options, proc Process, fs FileSystem, ctx *context.Context) Executor {
-	spinner, _ := yacspin.New(spinnerCfg)
+	renderer, err := NewRenderer(opts.Output, !opts.showsOutput(), proc)
+	if err != nil {
+		// Unknown modes are reported before running, see runTasks. Any other
+		// caller still gets output rather than a nil listener.
+		renderer, _ = NewRenderer(OutputPlain, !opts.showsOutput(), proc)
+	}
+	report := &RunReport{}
 
 	return Executor{
-		parser:   *p,
-		lockfile: *l,
-		spinner:  spinner,
-		options:  *opts,
-		process:  proc,
-		fs:       fs,
-		context:  *ctx,
+		parser:    *p,
+		lockfile:  *l,
+		listeners: []EventListener{report, renderer},
+		options:   *opts,
+		process:   proc,
+		fs:        fs,
+		context:   *ctx,
+
+		dispatched: make(map[string]error),
+		expanded:   make(map[string]Task),
+		staleness:  make(map[string]Staleness),
+		failed:     make(map[string]Staleness),
+		report:     report,
 	}
 }
 
-// Starts the command for a single run or as a watcher.
-func (e *Executor) Start(taskName string) {
-	arg := DefaultTask
-	if taskName != "" {
-		arg = taskName
+// Registers an additional listener for the events of the run.
+func (e *Executor) AddListener(listener EventListener) {
+	e.listeners = append(e.listeners, listener)
+}
+
+// Starts the commands for a single run or as a watcher.
+func (e *Executor) Start(taskNames []string) {
+	if len(taskNames) == 0 {
+		taskNames = []string{DefaultTask}
 	}
 
-	if e.options.Watch {
-		if err := e.watch(arg); err != nil {
+	switch {
+	case e.options.Check:
+		if err := e.check(taskNames); err != nil {
 			e.logErr(err)
 		}
-	} else {
-		if err := e.execute(arg); err != nil {
+	case e.options.Watch:
+		if err := e.watch(taskNames); err != nil {
+			e.logErr(err)
+		}
+	default:
+		if err := e.execute(taskNames); err != nil {
 			e.logErr(err)
 		}
 	}
 }
 
-// Executes all command strings under given taskName.
+// Executes all command strings under given task names.
 // Each call happens in its own go routine.
-func (e *Executor) execute(taskName string) error {
-	task := e.initTask(taskName)
-	didDispatch, err := e.checkAndDispatch(task)
+func (e *Executor) execute(taskNames []string) error {
+	tasks := e.initTasks(taskNames)
+	didDispatch, err := e.checkAndDispatchAll(tasks)
 
 	if err != nil {
 		return err
 	}
 
 	if !didDispatch {
-		e.logExit("success", "Nothing to run")
+		e.logExit(0, "Nothing to run")
 	}
 
-	e.spinner.StopMessage("Done!")
-	e.spinner.Stop()
+	e.emit(Event{Type: EventRunFinished, Message: "Done!"})
+	e.writeReport()
 
 	return nil
 }
 
 // Begins an infinite loop that watches for the file changes
-// in the "files" section of the task's configuration.
-func (e *Executor) watch(taskName string) error {
-	task := e.initTask(taskName)
+// in the "files" section of the tasks' configuration.
+func (e *Executor) watch(taskNames []string) error {
+	tasks := e.initTasks(taskNames)
 	wait := make(chan struct{})
 
-	if len(task.Files) == 0 {
-		return errors.New("task has no files to watch")
+	for _, task := range tasks {
+		if len(task.Files) == 0 {
+			return fmt.Errorf("task '%s' has no files to watch", task.Name)
+		}
 	}
 
 	for {
@@ -109,8 +135,11 @@ func (e *Executor) watch(taskName string) error {
 		}
 
 		go func(ch chan struct{}) {
-			e.checkAndDispatch(task)
-			e.spinner.Message("Watching for file changes...")
+			e.dispatched = make(map[string]error)
+			e.expanded = make(map[string]Task)
+			e.staleness = make(map[string]Staleness)
+			e.checkAndDispatchAll(tasks)
+			e.emit(Event{Type: EventMessage, Message: "Watching for file changes..."})
 
 			time.Sleep(time.Second)
 
@@ -127,119 +156,367 @@ func (e *Executor) watch(taskName string) error {
 	return nil
 }
 
+// Checks and dispatches the tasks in the given order. Stops at the first failure,
+// unless --continue is given, in which case all failures are reported at the end.
+// Returns true if any of the tasks was dispatched.
+func (e *Executor) checkAndDispatchAll(tasks []Task) (bool, error) {
+	didDispatch := false
+	failures := &taskFailures{}
+
+	for _, task := range tasks {
+		dispatched, err := e.checkAndDispatch(task)
+		didDispatch = didDispatch || dispatched
+
+		if err == nil {
+			continue
+		}
+
+		if !e.options.Continue {
+			return didDispatch, err
+		}
+
+		failures.add(task.Name, err)
+	}
+
+	if len(failures.errs) > 0 {
+		return didDispatch, failures
+	}
+
+	return didDispatch, nil
+}
+
 // Checks whether the task will be dispatched or not,
 // and then dispatches is true. Returns true if dispatched.
+// Tasks which already ran as part of this invocation are skipped.
 func (e *Executor) checkAndDispatch(task Task) (bool, error) {
+	e.rootTask = task.Name
+	// The hooks of this task must not see the failure of an earlier requested task.
+	e.lastErr = nil
+
+	task, err := e.expandTask(task)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := e.dispatched[task.Name]; ok {
+		return false, e.dispatchOnce(task, true)
+	}
+
 	shouldDispatch, err := e.shouldDispatch(task)
 	if err != nil {
 		return false, err
 	}
 
-	if shouldDispatch || e.options.Force {
-		if err := e.dispatchTask(task, true); err != nil {
-			return false, err
-		}
+	if !shouldDispatch && !e.options.Force {
+		e.emit(Event{Type: EventTaskSkipped, Task: task.Name, Reason: SkipUpToDate})
+
+		outputs := make(chan Ref[CommandOutput])
+		return false, e.runHooks(task, HookOnSkip, true, &outputs)
+	}
+
+	if err := e.dispatchOnce(task, true); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Dispatches the task unless it already ran as part of this invocation,
+// so that the work shared between the requested tasks is only done once.
+func (e *Executor) dispatchOnce(task Task, initialRun bool) error {
+	if err, ok := e.dispatched[task.Name]; ok {
+		e.emit(Event{Type: EventTaskSkipped, Task: task.Name, Reason: SkipAlreadyRan}.withResult(0, err))
+		return err
+	}
+
+	task, err := e.expandTask(task)
+	if err != nil {
+		return err
+	}
+
+	// The inputs are recorded as they were before the task ran,
+	// so that changes made while it runs aren't missed.
+	staleness, err := e.taskStaleness(task)
+	if err != nil {
+		return err
+	}
+
+	err = e.dispatchTask(task, initialRun)
+	if err == nil {
+		err = e.recordInputs(task, staleness)
+	} else if e.options.Watch {
+		e.failed[task.Name] = staleness
+	}
+
+	e.dispatched[task.Name] = err
+
+	return err
+}
+
+// Fetch the tasks from the parser based on the task names.
+// Every task must exist before any of them is run.
+func (e *Executor) initTasks(taskNames []string) []Task {
+	e.emit(Event{Type: EventRunStarted, Tasks: taskNames})
+
+	tasks := make([]Task, 0, len(taskNames))
+	for _, taskName := range taskNames {
+		e.mustExist(taskName)
+		task, _ := e.parser.GetTask(taskName)
+		tasks = append(tasks, task)
 	}
 
-	return (shouldDispatch || e.options.Force), nil
+	return tasks
 }
 
-// Fetch the task from the parser based on task name.
-func (e *Executor) initTask(taskName string) Task {
-	if !e.options.Quiet {
-		e.spinner.Start()
+// Returns the task with its environment resolved and its files as they are matched now. The
+// files are matched once per invocation, and again on every tick while watching, so that files
+// added since count.
+func (e *Executor) expandTask(task Task) (Task, error) {
+	if expanded, ok := e.expanded[task.Name]; ok {
+		return expanded, nil
 	}
 
-	e.mustExist(taskName)
-	task, _ := e.parser.GetTask(taskName)
-	return task
+	resolved, err := e.parser.ResolveTask(task)
+	if err != nil {
+		return task, err
+	}
+
+	expanded, err := e.parser.ExpandTask(resolved)
+	if err != nil {
+		return task, err
+	}
+
+	e.expanded[task.Name] = expanded
+	return expanded, nil
 }
 
-// Checks whether files have changed since the last run.
-// Also updates the lockfile if files did get modified.
-// If no "files" key is present in the task, simply returns true.
+// Checks whether the input files were added, removed or modified, or the other inputs
+// changed since the last successful run. Tasks without any inputs always run.
 func (e *Executor) shouldDispatch(task Task) (bool, error) {
-	if len(task.Files) == 0 {
+	if !task.hasInputs() {
 		return true, nil
 	}
 
-	dispatchCh := make(chan Ref[bool])
-	go e.shouldDispatchRoutine(task, dispatchCh)
-	dispatch := <-dispatchCh
+	staleness, err := e.taskStaleness(task)
+	if err != nil {
+		return false, err
+	}
 
-	if dispatch.Error() != nil {
-		return false, dispatch.Error()
+	// While watching, a failed task waits for its inputs to change again.
+	if failed, ok := e.failed[task.Name]; ok && failed.sameInputs(staleness) {
+		return false, nil
 	}
 
-	if dispatch.Value() {
-		e.lockfile.UpdateTimestampsForFiles(task.Files)
+	if staleness.Stale() && e.options.Verbose {
+		e.emit(Event{Type: EventMessage, Task: task.Name, Message: fmt.Sprintf("Running '%s': %s", task.Name, staleness.Reason())})
 	}
 
-	return dispatch.Value(), nil
+	return staleness.Stale(), nil
 }
 
-// Go Routine function that determines whether the stored
-// mtime is greater  than mtime if the file at this moment.
-func (e *Executor) shouldDispatchRoutine(task Task, ch chan Ref[bool]) {
-	lockedModTimes := e.lockfile.GetCurrentProject()
+// Returns how the input files of the task changed since its last successful run.
+// The result is kept, so that the files are checked once per invocation.
+func (e *Executor) taskStaleness(task Task) (Staleness, error) {
+	if staleness, ok := e.staleness[task.Name]; ok {
+		return staleness, nil
+	}
 
-	for _, f := range task.Files {
-		fo, err := e.fs.Stat(f)
-		if err != nil {
-			ch <- NewRef(false, err)
-		}
+	task, err := e.expandTask(task)
+	if err != nil {
+		return Staleness{}, err
+	}
 
-		modTimeNow := fo.ModTime().Unix()
+	inputs, err := e.inputFingerprints(task)
+	if err != nil {
+		return Staleness{}, err
+	}
 
-		if lockedModTimes[f] < modTimeNow {
-			ch <- NewRef(true, nil)
-			return
-		}
+	staleness, err := e.lockfile.Staleness(task, inputs)
+	if err != nil {
+		return Staleness{}, err
 	}
 
-	ch <- NewRef(false, nil)
+	e.staleness[task.Name] = staleness
+	return staleness, nil
+}
+
+// Returns the files of the task which were added or modified since the last run.
+// All files count as changed for a task which never ran successfully.
+func (e *Executor) changedFiles(task Task) ([]string, error) {
+	task, err := e.expandTask(task)
+	if err != nil {
+		return nil, err
+	}
+
+	staleness, err := e.taskStaleness(task)
+	if err != nil {
+		return nil, err
+	}
+
+	if staleness.NeverRan {
+		return task.Files, nil
+	}
+
+	return staleness.ChangedFiles(), nil
+}
+
+// Returns the changed files of the task as seen by its commands.
+// With --force all files of the task count as changed.
+func (e *Executor) changedFilesForRun(task Task) ([]string, error) {
+	if e.options.Force {
+		task, err := e.expandTask(task)
+		return task.Files, err
+	}
+
+	return e.changedFiles(task)
+}
+
+// Records the input files of a task which succeeded in the lockfile,
+// so that the next invocation only runs it when they change.
+func (e *Executor) recordInputs(task Task, staleness Staleness) error {
+	if !task.hasInputs() {
+		return nil
+	}
+
+	delete(e.failed, task.Name)
+	return e.lockfile.RecordTask(task, staleness)
+}
+
+// Records the current inputs of the task as if it succeeded, without running it.
+func (e *Executor) Touch(task Task) error {
+	if !task.hasInputs() {
+		return fmt.Errorf("task '%s' has no files or inputs, it always runs", task.Name)
+	}
+
+	task, err := e.expandTask(task)
+	if err != nil {
+		return err
+	}
+
+	staleness, err := e.taskStaleness(task)
+	if err != nil {
+		return err
+	}
+
+	return e.lockfile.RecordTask(task, staleness)
 }
 
 // Dispatches the individual commands of the current task,
 // including any events that need to be run.
-func (e *Executor) dispatchTask(task Task, initialRun bool) error {
-	outputs := make(chan Ref[string])
-	global := e.parser.GetGlobal()
+// Arguments given after "--" are only passed to the main commands of the initial task.
+func (e *Executor) dispatchTask(task Task, initialRun bool) (err error) {
+	outputs := make(chan Ref[CommandOutput])
+
+	task, err = e.expandTask(task)
+	if err != nil {
+		return err
+	}
+
+	if err := e.confirm(task); err != nil {
+		return err
+	}
 
+	start := time.Now()
+	e.emit(Event{Type: EventTaskStarted, Task: task.Name})
+	defer func() {
+		e.emit(Event{Type: EventTaskFinished, Task: task.Name}.withResult(time.Since(start), err))
+	}()
+
+	if task.Interactive && e.options.LogFormat == LogFormatJSON && e.options.LogFile == "" {
+		return fmt.Errorf("task '%s' is interactive and can't share stdout with the JSON event log, use --log-file", task.Name)
+	}
+
+	err = e.runTask(task, initialRun, &outputs)
+	return e.runOutcomeHooks(task, initialRun, err, &outputs)
+}
+
+// Runs the commands of the task along with the hooks around them.
+func (e *Executor) runTask(task Task, initialRun bool, outputs *chan Ref[CommandOutput]) error {
+	var args []string
 	if initialRun {
-		for _, beforeEachCmd := range global.Shared.Events.BeforeEachTask {
-			err := e.runSysOrRecurse(beforeEachCmd, &outputs)
+		args = e.options.Args
+	}
 
-			if err != nil {
-				return err
-			}
-		}
+	if err := e.runHooks(task, HookBeforeEachTask, initialRun, outputs); err != nil {
+		return err
 	}
 
 	for _, mainCmd := range task.Run {
-		if initialRun {
-			for _, beforeEachCmd := range global.Shared.Events.BeforeEachRun {
-				if err := e.runSysOrRecurse(beforeEachCmd, &outputs); err != nil {
-					return err
-				}
-			}
+		if err := e.runHooks(task, HookBeforeEachRun, initialRun, outputs); err != nil {
+			return err
 		}
 
-		if err := e.runSysOrRecurse(mainCmd, &outputs); err != nil {
+		if dep, ok := e.parser.GetTask(mainCmd); ok {
+			if err := e.dispatchOnce(dep, false); err != nil {
+				return err
+			}
+		} else if err := e.runSysOrRecurse(task, mainCmd, args, task.Interactive, outputs); err != nil {
 			return err
 		}
 
-		if initialRun {
-			for _, afterEachCmd := range global.Shared.Events.AfterEachRun {
-				if err := e.runSysOrRecurse(afterEachCmd, &outputs); err != nil {
-					return err
-				}
-			}
+		if err := e.runHooks(task, HookAfterEachRun, initialRun, outputs); err != nil {
+			return err
 		}
 	}
 
-	for _, afterEachCmd := range global.Shared.Events.AfterEachTask {
-		if err := e.runSysOrRecurse(afterEachCmd, &outputs); err != nil {
+	return e.runHooks(task, HookAfterEachTask, initialRun, outputs)
+}
+
+// Runs the on_success or on_failure hooks depending on the error
+// the task finished with, followed by the finally hooks.
+// The error of the task takes precedence over the errors of these hooks.
+func (e *Executor) runOutcomeHooks(task Task, initialRun bool, err error, outputs *chan Ref[CommandOutput]) error {
+	hook := HookOnSuccess
+	if err != nil {
+		hook = HookOnFailure
+	}
+
+	hookErr := e.runHooks(task, hook, initialRun, outputs)
+	if finallyErr := e.runHooks(task, HookFinally, initialRun, outputs); hookErr == nil {
+		hookErr = finallyErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return hookErr
+}
+
+// Runs the global and the task's own commands of the hook. The task's
+// commands run after the global ones for the before_* hooks, and before
+// them for all the others. Failures are handled per the hook failure policy.
+func (e *Executor) runHooks(task Task, hook string, initialRun bool, outputs *chan Ref[CommandOutput]) error {
+	global := e.parser.GetGlobal().Shared.Events
+
+	var globalCommands []string
+	if e.globalHookApplies(task, hook, initialRun) {
+		globalCommands = global.commands(hook)
+	}
+
+	var commands []string
+	if strings.HasPrefix(hook, "before_") {
+		commands = append(append(commands, globalCommands...), task.Events.commands(hook)...)
+	} else {
+		commands = append(append(commands, task.Events.commands(hook)...), globalCommands...)
+	}
+
+	policy := task.Events.HookFailure
+	if policy == "" {
+		policy = global.HookFailure
+	}
+
+	for _, cmd := range commands {
+		err := e.runHook(task, hook, cmd, outputs)
+		if err == nil {
+			continue
+		}
+
+		switch policy {
+		case HookFailureIgnore:
+		case HookFailureWarn:
+			e.emit(Event{Type: EventMessage, Task: task.Name, Hook: hook, Message: fmt.Sprintf("Warning: %s hook of task '%s' failed: %s", hook, task.Name, err)})
+		default:
 			return err
 		}
 	}
@@ -247,81 +524,219 @@ func (e *Executor) dispatchTask(task Task, initialRun bool) error {
 	return nil
 }
 
-// Determine what to execute: system command or another declared task in goke.yml.
-func (e *Executor) runSysOrRecurse(cmd string, ch *chan Ref[string]) error {
-	if !e.options.Quiet {
-		message := cmd
-		if len(e.options.Args) > 0 {
-			message = fmt.Sprintf("%s %s", message, JoinInnerArgs(e.options.Args))
-		}
+// Asks for confirmation if the task has a prompt, unless --yes is given.
+// Without a terminal to ask on, the task fails.
+func (e *Executor) confirm(task Task) error {
+	if task.Prompt == "" || e.options.Yes {
+		return nil
+	}
 
-		e.spinner.Message(fmt.Sprintf("Running: %s", message))
+	e.emit(Event{Type: EventPrompt, Task: task.Name, Message: task.Prompt})
+	confirmed, err := e.process.Confirm(task.Prompt)
+	e.emit(Event{Type: EventPromptAnswered, Task: task.Name, Confirmed: &confirmed})
+
+	if errors.Is(err, ErrNotInteractive) {
+		return fmt.Errorf("task '%s' needs confirmation, but %s; pass --yes to confirm", task.Name, err)
 	}
 
-	if task, ok := e.parser.GetTask(cmd); ok {
-		return e.dispatchTask(task, false)
-	} else {
-		go e.runSysCommand(cmd, *ch)
-		output := <-*ch
+	if err != nil {
+		return err
+	}
+
+	if !confirmed {
+		return fmt.Errorf("task '%s' was not confirmed", task.Name)
+	}
+
+	return nil
+}
 
-		if output.Error() != nil {
-			return output.Error()
+// Whether the global hook runs for the task, as decided by the hook scope
+// and the hooks the task is excluded from. A task's own hooks always run.
+func (e *Executor) globalHookApplies(task Task, hook string, initialRun bool) bool {
+	if e.hookDepth > 0 || task.skipsHook(hook) {
+		return false
+	}
+
+	if initialRun {
+		return true
+	}
+
+	switch e.parser.GetGlobal().Shared.Events.Scope {
+	case HookScopeEveryCommand:
+		return true
+	case HookScopeEveryTask:
+		return hook != HookBeforeEachRun && hook != HookAfterEachRun
+	default:
+		return false
+	}
+}
+
+// Runs a single command of the given hook on behalf of the task.
+func (e *Executor) runHook(task Task, hook string, cmd string, ch *chan Ref[CommandOutput]) error {
+	e.hookDepth++
+	defer func() { e.hookDepth-- }()
+
+	start := time.Now()
+	e.emit(Event{Type: EventHookStarted, Task: task.Name, Hook: hook, Command: cmd})
+
+	err := e.runSysOrRecurse(task, cmd, nil, false, ch)
+	e.emit(Event{Type: EventHookFinished, Task: task.Name, Hook: hook, Command: cmd}.withResult(time.Since(start), err))
+
+	return err
+}
+
+// Determine what to execute: system command or another declared task in goke.yml.
+// The args are appended to system commands, nested tasks never receive them.
+// The given task is the one on whose behalf the command runs. Interactive
+// commands are attached to the terminal, so none of their output is captured.
+func (e *Executor) runSysOrRecurse(task Task, cmd string, args []string, interactive bool, ch *chan Ref[CommandOutput]) error {
+	if nested, ok := e.parser.GetTask(cmd); ok {
+		return e.dispatchTask(nested, false)
+	}
+
+	if strings.Contains(cmd, ChangedFilesPlaceholder) {
+		changed, err := e.changedFilesForRun(task)
+		if err != nil {
+			return err
 		}
 
-		if !e.options.Quiet {
-			e.process.Fprint(os.Stdout, output.Value())
+		if len(changed) == 0 && task.SkipIfNoChanges {
+			e.emit(Event{Type: EventMessage, Task: task.Name, Command: cmd, Message: fmt.Sprintf("Skipping '%s': no files changed", cmd)})
+			return nil
 		}
+
+		cmd = strings.ReplaceAll(cmd, ChangedFilesPlaceholder, strings.Join(changed, " "))
 	}
 
-	return nil
+	message := cmd
+	if len(args) > 0 {
+		message = fmt.Sprintf("%s %s", message, JoinInnerArgs(args))
+	}
+
+	if err := e.setRunEnv(task); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	e.emit(Event{Type: EventCommandStarted, Task: task.Name, Command: message, Interactive: interactive})
+
+	go e.runSysCommand(cmd, args, interactive, *ch)
+	output := <-*ch
+	err := output.Error()
+	if err != nil {
+		err = newCommandError(task.Name, message, err)
+	}
+
+	if stdout := output.Value().Stdout; stdout != "" {
+		e.emit(Event{Type: EventCommandOutput, Task: task.Name, Command: message, Stream: StreamStdout, Data: stdout})
+	}
+
+	// Successful commands may write warnings to stderr as well.
+	stderr := output.Value().Stderr
+	if stderr == "" {
+		stderr = commandStderr(err)
+	}
+
+	if stderr != "" {
+		e.emit(Event{Type: EventCommandOutput, Task: task.Name, Command: message, Stream: StreamStderr, Data: stderr})
+	}
+
+	e.emit(Event{Type: EventCommandFinished, Task: task.Name, Command: message, Interactive: interactive}.withResult(time.Since(start), err))
+
+	if e.hookDepth == 0 {
+		e.lastErr = err
+	}
+
+	return err
+}
+
+// What a command wrote to stdout and to stderr.
+type CommandOutput struct {
+	Stdout string
+	Stderr string
 }
 
 // Executes the given string in the underlying OS.
-func (e *Executor) runSysCommand(c string, ch chan Ref[string]) {
-	splitCmd, err := cli.ParseCommandLine(os.ExpandEnv(c))
+func (e *Executor) runSysCommand(c string, args []string, interactive bool, ch chan Ref[CommandOutput]) {
+	splitCmd, err := splitCommandLine(c)
 
 	if err != nil {
-		ch <- NewRef("", err)
+		ch <- NewRef(CommandOutput{}, err)
 		return
 	}
 
-	wholeCmd := append(splitCmd[1:], e.options.Args...)
-	out, err := e.process.Execute(splitCmd[0], wholeCmd...)
+	wholeCmd := append(splitCmd[1:], args...)
 
-	if err != nil {
-		ch <- NewRef("", err)
+	if interactive {
+		ch <- NewRef(CommandOutput{}, e.process.ExecuteInteractive(splitCmd[0], wholeCmd...))
 		return
 	}
 
-	ch <- NewRef("\n"+string(out)+"\n", nil)
+	stdout, stderr, err := e.process.Execute(splitCmd[0], wholeCmd...)
+	ch <- NewRef(CommandOutput{Stdout: string(stdout), Stderr: string(stderr)}, err)
 }
 
 func (e *Executor) mustExist(taskName string) {
 	if _, ok := e.parser.GetTask(taskName); !ok {
-		e.logExit("error", fmt.Sprintf("Command '%s' not found\n", taskName))
+		e.logExit(ExitInfraError, fmt.Sprintf("Command '%s' not found\n", taskName))
 	}
 }
 
-// Shortcut to logging an error using spinner logger.
+// Shortcut to logging an error.
 func (e *Executor) logErr(err error) {
-	e.logExit("error", fmt.Sprintf("Error: %s\n", err.Error()))
+	e.logExit(e.failureExitCode(err), formatError(err))
 }
 
-// Log to the console using the spinner instance.
-func (e *Executor) logExit(status string, message string) {
-	switch status {
-	default:
-	case "success":
-		if !e.options.Quiet {
-			e.spinner.StopMessage(message)
-			e.spinner.Stop()
-		}
-		e.process.Exit(0)
-	case "error":
-		if !e.options.Quiet {
-			e.spinner.StopFailMessage(message)
-			e.spinner.StopFail()
-		}
-		e.process.Exit(1)
+// Finishes the run with the given message, then exit with the given code.
+func (e *Executor) logExit(code int, message string) {
+	message = strings.TrimRight(message, "\n")
+
+	if code == 0 {
+		e.emit(Event{Type: EventRunFinished, Message: message})
+	} else {
+		e.emit(Event{Type: EventRunFinished, Message: message, Error: message})
+	}
+
+	e.writeReport()
+	e.process.Exit(code)
+}
+
+// Returns the exit code of the first failed command, or the one given via
+// --failure-exit-code. Any other error is an infrastructure error.
+func (e *Executor) failureExitCode(err error) int {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return ExitInfraError
+	}
+
+	if e.options.FailureExitCode != 0 {
+		return e.options.FailureExitCode
+	}
+
+	return cmdErr.ExitCode
+}
+
+// Outputs the summary of the run, and the command timings if requested.
+// Nothing is written in watch mode, or before any task was looked at.
+func (e *Executor) writeReport() {
+	if !e.options.showsOutput() || e.options.Watch || len(e.report.Tasks) == 0 {
+		return
+	}
+
+	report := "\n" + e.report.Summary()
+	if e.options.Timings {
+		report += "\n" + e.report.Timings()
+	}
+
+	e.process.Fprint(os.Stdout, report)
+}
+
+// Sends the event to every listener.
+func (e *Executor) emit(event Event) {
+	event.Version = EventSchemaVersion
+	event.Time = time.Now()
+
+	for _, listener := range e.listeners {
+		listener.Handle(event)
 	}
 }
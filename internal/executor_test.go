@@ -2,25 +2,37 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dugajean/goke/internal/tests"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func getDependencies(t *testing.T, opts *Options) (*Parseable, *Lockfile, *tests.Process, FileSystem) {
+	return getDependenciesForConfig(t, opts, tests.YamlConfigStub)
+}
+
+func getDependenciesForConfig(t *testing.T, opts *Options, config string) (*Parseable, *Lockfile, *tests.Process, FileSystem) {
 	fsMock := mockCacheDoesNotExist(t)
 	fsMock.On("FileExists", mock.Anything).Return(false)
 	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{}, nil)
-	fsMock.On("ReadFile", mock.Anything).Return([]byte(dotGokeFile), nil)
-	fsMock.On("Glob", mock.Anything).Return(tests.ExpectedGlob, nil)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil).Maybe()
+	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{}, nil).Maybe()
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(dotGokeFile), nil).Maybe()
+	fsMock.On("Glob", mock.MatchedBy(isParserCachePath)).Return([]string{}, nil).Maybe()
+	fsMock.On("Glob", mock.Anything).Return(tests.ExpectedGlob, nil).Maybe()
 
 	process := tests.NewProcess(t)
 
-	parser := NewParser(tests.YamlConfigStub, opts, fsMock)
-	lockfile := NewLockfile(files, opts, fsMock)
+	parser := NewParser(config, opts, fsMock)
+	lockfile := NewLockfile(opts, fsMock)
 
 	parser.Bootstrap()
 	lockfile.Bootstrap()
@@ -28,18 +40,32 @@ func getDependencies(t *testing.T, opts *Options) (*Parseable, *Lockfile, *tests
 	return &parser, &lockfile, process, fsMock
 }
 
+// Whether the path is in the parser cache dir of the mocked file systems.
+func isParserCachePath(p string) bool {
+	return strings.HasPrefix(p, "path/to/cache/goke/parser/")
+}
+
+// Returns the error of a command which wrote the text to stderr and exited with the code.
+func exitError(t require.TestingT, code int, stderr string) error {
+	_, err := exec.Command("sh", "-c", fmt.Sprintf("echo '%s' >&2; exit %d", stderr, code)).Output()
+	require.NotNil(t, err)
+
+	return err
+}
+
 func TestStartNonWatch(t *testing.T) {
 	parser, lockfile, process, fsMock := getDependencies(t, &clearCacheOpts)
 
-	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte("foo"), nil)
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte("foo"), nil, nil)
 	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
 
 	ctx := context.Background()
 	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
-	executor.Start("greet-loki")
+	executor.Start([]string{"greet-loki"})
 
+	// The command output and the run summary.
 	process.AssertNumberOfCalls(t, "Execute", 1)
-	process.AssertNumberOfCalls(t, "Fprint", 1)
+	process.AssertNumberOfCalls(t, "Fprint", 2)
 
 	process.AssertExpectations(t)
 }
@@ -55,10 +81,780 @@ func TestStartWatchWithNoFiles(t *testing.T) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	executor := NewExecutor(parser, lockfile, &watchOpts, process, fsMock, &ctx)
-	executor.Start("greet-loki")
+	executor.Start([]string{"greet-loki"})
 	cancel()
 
 	process.AssertNotCalled(t, "Execute")
 	process.AssertNotCalled(t, "Fprint")
 	process.AssertNumberOfCalls(t, "Exit", 1)
 }
+
+func TestStartPassesArgsOnlyToMainCommands(t *testing.T) {
+	argsOpts := Options{
+		NoCache: true,
+		Force:   true,
+		Args:    []string{"--loud"},
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &argsOpts)
+
+	process.On("Execute", "echo", "Hello Frey", "--loud").Return([]byte("foo"), nil, nil).Once()
+	process.On("Execute", "echo", "Hello Sunny", "--loud").Return([]byte("foo"), nil, nil).Once()
+	process.On("Execute", "echo", "Hello Boki").Return([]byte("foo"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &argsOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-cats"})
+
+	process.AssertNumberOfCalls(t, "Execute", 3)
+}
+
+func TestStartMultipleTasksRunsSharedTasksOnce(t *testing.T) {
+	forceOpts := Options{
+		NoCache: true,
+		Force:   true,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &forceOpts)
+
+	process.On("Execute", "echo", "Hello Frey").Return([]byte("foo"), nil, nil).Once()
+	process.On("Execute", "echo", "Hello Sunny").Return([]byte("foo"), nil, nil).Once()
+	process.On("Execute", "echo", "Hello Boki").Return([]byte("foo"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-cats", "greet-loki", "greet-cats"})
+
+	process.AssertNumberOfCalls(t, "Execute", 3)
+}
+
+func TestStartMultipleTasksWithContinue(t *testing.T) {
+	continueOpts := Options{
+		NoCache:  true,
+		Force:    true,
+		Continue: true,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &continueOpts)
+
+	process.On("Execute", "echo", "Hello Boki").Return(nil, nil, exitError(t, 2, "boom")).Once()
+	process.On("Execute", "echo", "Hello Lisha!").Return([]byte("foo"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 2).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &continueOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-loki", "greet-lisha"})
+
+	process.AssertNumberOfCalls(t, "Execute", 2)
+	process.AssertNumberOfCalls(t, "Exit", 1)
+}
+
+func TestStartMultipleTasksStopsAtFirstFailure(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependencies(t, &clearCacheOpts)
+
+	process.On("Execute", "echo", "Hello Boki").Return(nil, nil, exitError(t, 2, "boom")).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 2).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-loki", "greet-lisha"})
+
+	process.AssertNumberOfCalls(t, "Execute", 1)
+}
+
+func TestStartRecordsRunReport(t *testing.T) {
+	forceOpts := Options{
+		NoCache: true,
+		Force:   true,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &forceOpts)
+
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte("foo"), nil, nil)
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-cats", "greet-loki"})
+
+	statuses := []TaskStatus{}
+	for _, result := range executor.report.Tasks {
+		statuses = append(statuses, result.Status)
+	}
+
+	require.Equal(t, []TaskStatus{TaskRan, TaskRan, TaskCached}, statuses)
+	require.Equal(t, "greet-loki", executor.report.Tasks[0].Task)
+	require.Equal(t, "greet-cats", executor.report.Tasks[1].Task)
+	require.Len(t, executor.report.Commands, 3)
+}
+
+type recordingListener struct {
+	events []Event
+}
+
+func (l *recordingListener) Handle(event Event) {
+	l.events = append(l.events, event)
+}
+
+func TestStartEmitsEvents(t *testing.T) {
+	jsonOpts := Options{
+		NoCache:   true,
+		Force:     true,
+		LogFormat: LogFormatJSON,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &jsonOpts)
+
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte("foo"), nil, nil)
+
+	ctx := context.Background()
+	listener := &recordingListener{}
+	executor := NewExecutor(parser, lockfile, &jsonOpts, process, fsMock, &ctx)
+	executor.AddListener(listener)
+	executor.Start([]string{"greet-loki", "greet-loki"})
+
+	types := []EventType{}
+	for _, event := range listener.events {
+		require.Equal(t, EventSchemaVersion, event.Version)
+		types = append(types, event.Type)
+	}
+
+	require.Equal(t, []EventType{
+		EventRunStarted,
+		EventTaskStarted,
+		EventCommandStarted,
+		EventCommandOutput,
+		EventCommandFinished,
+		EventTaskFinished,
+		EventTaskSkipped,
+		EventRunFinished,
+	}, types)
+
+	require.Equal(t, `echo "Hello Boki"`, listener.events[2].Command)
+	require.Equal(t, "foo", listener.events[3].Data)
+	require.Equal(t, 0, *listener.events[5].ExitCode)
+	require.Equal(t, SkipAlreadyRan, listener.events[6].Reason)
+
+	// The event log is written to stdout, so nothing else is.
+	process.AssertNotCalled(t, "Fprint", mock.Anything, mock.Anything)
+}
+
+func TestStartEmitsStderrOfSuccessfulCommands(t *testing.T) {
+	jsonOpts := Options{
+		NoCache:   true,
+		Force:     true,
+		LogFormat: LogFormatJSON,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &jsonOpts)
+
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte("foo"), []byte("warning: deprecated"), nil)
+
+	ctx := context.Background()
+	listener := &recordingListener{}
+	executor := NewExecutor(parser, lockfile, &jsonOpts, process, fsMock, &ctx)
+	executor.AddListener(listener)
+	executor.Start([]string{"greet-loki"})
+
+	outputs := map[string]string{}
+	for _, event := range listener.events {
+		if event.Type == EventCommandOutput {
+			outputs[event.Stream] = event.Data
+		}
+	}
+
+	require.Equal(t, map[string]string{StreamStdout: "foo", StreamStderr: "warning: deprecated"}, outputs)
+}
+
+func TestShellProcessExecuteCapturesStderr(t *testing.T) {
+	process := &ShellProcess{}
+
+	stdout, stderr, err := process.Execute("sh", "-c", "echo out; echo warning >&2")
+	require.Nil(t, err)
+	require.Equal(t, "out\n", string(stdout))
+	require.Equal(t, "warning\n", string(stderr))
+
+	_, stderr, err = process.Execute("sh", "-c", "echo boom >&2; exit 2")
+	require.Equal(t, "boom\n", string(stderr))
+	require.Equal(t, "boom\n", commandStderr(err))
+}
+
+func TestNewExecutorFallsBackToPlainOutput(t *testing.T) {
+	badOpts := Options{NoCache: true, Force: true, Output: "fancy"}
+	parser, lockfile, process, fsMock := getDependencies(t, &badOpts)
+
+	process.On("Execute", "echo", "Hello Boki").Return([]byte("foo"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &badOpts, process, fsMock, &ctx)
+	require.NotPanics(t, func() { executor.Start([]string{"greet-loki"}) })
+}
+
+func TestStartLeavesOutEmptyOutput(t *testing.T) {
+	jsonOpts := Options{
+		NoCache:   true,
+		Force:     true,
+		LogFormat: LogFormatJSON,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &jsonOpts)
+
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte(""), nil, nil)
+
+	ctx := context.Background()
+	listener := &recordingListener{}
+	executor := NewExecutor(parser, lockfile, &jsonOpts, process, fsMock, &ctx)
+	executor.AddListener(listener)
+	executor.Start([]string{"greet-loki"})
+
+	for _, event := range listener.events {
+		require.NotEqual(t, EventCommandOutput, event.Type)
+	}
+}
+
+func TestStartFailureExitCode(t *testing.T) {
+	failureOpts := Options{
+		NoCache:         true,
+		Force:           true,
+		FailureExitCode: 3,
+	}
+
+	parser, lockfile, process, fsMock := getDependencies(t, &failureOpts)
+
+	process.On("Execute", "echo", "Hello Boki").Return(nil, nil, exitError(t, 2, "boom")).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 3).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &failureOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-loki"})
+}
+
+func TestStartInfraErrorExitCode(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependencies(t, &clearCacheOpts)
+
+	process.On("Execute", "echo", "Hello Boki").Return(nil, nil, errors.New("exec: \"echo\": executable file not found in $PATH")).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", ExitInfraError).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	executor.Start([]string{"greet-loki"})
+}
+
+const interactiveConfig = `
+db:
+  interactive: true
+  files: [cmd/cli/*]
+  run:
+    - "psql -U postgres"
+    - "greet"
+
+greet:
+  run:
+    - "echo hi"
+`
+
+func TestStartInteractiveTask(t *testing.T) {
+	forceOpts := Options{
+		NoCache: true,
+		Force:   true,
+		Output:  OutputPlain,
+	}
+
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, interactiveConfig)
+
+	process.On("ExecuteInteractive", "psql", "-U", "postgres").Return(nil).Once()
+	process.On("Execute", "echo", "hi").Return([]byte("hi"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"db"})
+}
+
+func TestStartInteractiveTaskWithJSONLogOnStdout(t *testing.T) {
+	jsonOpts := Options{
+		NoCache:   true,
+		Force:     true,
+		LogFormat: LogFormatJSON,
+	}
+
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &jsonOpts, interactiveConfig)
+	process.On("Exit", ExitInfraError).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &jsonOpts, process, fsMock, &ctx)
+	executor.Start([]string{"db"})
+
+	process.AssertNotCalled(t, "ExecuteInteractive", mock.Anything, mock.Anything, mock.Anything)
+}
+
+const promptConfig = `
+global:
+  events:
+    before_each_task:
+      - "echo 'before task'"
+
+db-reset:
+  prompt: "Really reset the database?"
+  files: [cmd/cli/*]
+  run:
+    - "echo reset"
+`
+
+func TestStartPromptConfirmed(t *testing.T) {
+	forceOpts := Options{
+		NoCache: true,
+		Force:   true,
+		Output:  OutputPlain,
+	}
+
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, promptConfig)
+
+	process.On("Confirm", "Really reset the database?").Return(true, nil).Once()
+	process.On("Execute", "echo", "before task").Return([]byte("before task"), nil, nil).Once()
+	process.On("Execute", "echo", "reset").Return([]byte("reset"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"db-reset"})
+}
+
+func TestStartPromptDeclined(t *testing.T) {
+	forceOpts := Options{
+		NoCache: true,
+		Force:   true,
+		Output:  OutputPlain,
+	}
+
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, promptConfig)
+
+	process.On("Confirm", "Really reset the database?").Return(false, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", ExitInfraError).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"db-reset"})
+
+	process.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything)
+}
+
+func TestStartPromptNotInteractive(t *testing.T) {
+	forceOpts := Options{
+		NoCache: true,
+		Force:   true,
+		Output:  OutputPlain,
+	}
+
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, promptConfig)
+
+	var out string
+	process.On("Confirm", "Really reset the database?").Return(false, ErrNotInteractive).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		out += args.String(1)
+	}).Return(10, nil)
+	process.On("Exit", ExitInfraError).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"db-reset"})
+
+	require.Contains(t, out, "pass --yes to confirm")
+}
+
+func TestStartPromptWithYes(t *testing.T) {
+	yesOpts := Options{
+		NoCache: true,
+		Force:   true,
+		Yes:     true,
+		Output:  OutputPlain,
+	}
+
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &yesOpts, promptConfig)
+
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return([]byte("foo"), nil, nil).Twice()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &yesOpts, process, fsMock, &ctx)
+	executor.Start([]string{"db-reset"})
+
+	process.AssertNotCalled(t, "Confirm", mock.Anything)
+}
+
+const hooksConfig = `
+global:
+  events:
+    before_each_task:
+      - "echo 'global before'"
+    after_each_task:
+      - "echo 'global after'"
+
+build:
+  files: [cmd/cli/*]
+  events:
+    before_each_task:
+      - "echo 'build before'"
+    after_each_task:
+      - "echo 'build after'"
+    on_success:
+      - "echo 'build succeeded'"
+    on_failure:
+      - "echo 'build failed'"
+    finally:
+      - "echo 'build cleanup'"
+    on_skip:
+      - "echo 'build skipped'"
+  run:
+    - "go build"
+`
+
+// Records the arguments of every executed command, in order.
+func recordExecutions(t *testing.T, process *tests.Process, failing string) *[]string {
+	executed := []string{}
+	failure := exitError(t, 2, "boom")
+	process.On("Execute", mock.Anything, mock.AnythingOfType("string")).Return(func(name string, args ...string) []byte {
+		executed = append(executed, args[0])
+		return []byte("foo")
+	}, nil, func(name string, args ...string) error {
+		if args[0] == failing {
+			return failure
+		}
+		return nil
+	})
+
+	return &executed
+}
+
+func TestStartTaskHooksOnSuccess(t *testing.T) {
+	forceOpts := Options{NoCache: true, Force: true, Output: OutputPlain}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, hooksConfig)
+
+	executed := recordExecutions(t, process, "")
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	require.Equal(t, []string{
+		"global before",
+		"build before",
+		"build",
+		"build after",
+		"global after",
+		"build succeeded",
+		"build cleanup",
+	}, *executed)
+}
+
+func TestStartTaskHooksOnFailure(t *testing.T) {
+	forceOpts := Options{NoCache: true, Force: true, Output: OutputPlain}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, hooksConfig)
+
+	executed := recordExecutions(t, process, "build")
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 2).Return().Once()
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	require.Equal(t, []string{"global before", "build before", "build", "build failed", "build cleanup"}, *executed)
+}
+
+func TestStartTaskHooksFailurePolicy(t *testing.T) {
+	forceOpts := Options{NoCache: true, Force: true, Output: OutputPlain}
+	config := strings.Replace(hooksConfig, "  run:\n", "    hook_failure: warn\n  run:\n", 1)
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, config)
+
+	var out string
+	executed := recordExecutions(t, process, "build before")
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		out += args.String(1)
+	}).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	require.Contains(t, *executed, "build succeeded")
+	require.Contains(t, out, "Warning: before_each_task hook of task 'build' failed")
+}
+
+func TestStartTaskHooksOnSkip(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, hooksConfig)
+
+	executed := recordExecutions(t, process, "")
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 0).Return().Once()
+
+	// The first run records the files of the task, so the second one skips it.
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	*executed = nil
+	executor = NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	require.Equal(t, []string{"build skipped"}, *executed)
+}
+
+const scopesConfig = `
+global:
+  events:
+    scope: %s
+    before_each_task:
+      - "echo 'before task'"
+    after_each_run:
+      - "echo 'after run'"
+      - "notify"
+
+notify:
+  run:
+    - "echo 'notify'"
+
+lint:
+  run:
+    - "echo 'lint'"
+
+build:
+  %s
+  files: [cmd/cli/*]
+  run:
+    - "lint"
+    - "echo 'build'"
+`
+
+func runScopesConfig(t *testing.T, scope string, exclusion string) []string {
+	forceOpts := Options{NoCache: true, Force: true, Output: OutputPlain}
+	config := fmt.Sprintf(scopesConfig, scope, exclusion)
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, config)
+
+	executed := recordExecutions(t, process, "")
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build"})
+
+	return *executed
+}
+
+func TestStartHookScopes(t *testing.T) {
+	topLevel := []string{
+		"before task",
+		"lint",
+		"after run", "notify",
+		"build",
+		"after run", "notify",
+	}
+
+	everyTask := []string{
+		"before task",
+		"before task", "lint",
+		"after run", "notify",
+		"build",
+		"after run", "notify",
+	}
+
+	everyCommand := []string{
+		"before task",
+		"before task", "lint", "after run", "notify",
+		"after run", "notify",
+		"build",
+		"after run", "notify",
+	}
+
+	require.Equal(t, topLevel, runScopesConfig(t, HookScopeTopLevel, ""))
+	require.Equal(t, everyTask, runScopesConfig(t, HookScopeEveryTask, ""))
+	require.Equal(t, everyCommand, runScopesConfig(t, HookScopeEveryCommand, ""))
+}
+
+func TestStartHookExclusions(t *testing.T) {
+	require.Equal(t, []string{"lint", "build"}, runScopesConfig(t, HookScopeTopLevel, "hooks: false"))
+
+	// Only the excluded task itself skips the hooks, the tasks it invokes don't.
+	require.Equal(t, []string{"before task", "lint", "build"}, runScopesConfig(t, HookScopeEveryTask, "skip_hooks: [before_each_task, after_each_run]"))
+}
+
+const changedFilesConfig = `
+fmt:
+  files: [cmd/cli/*]
+  run:
+    - "gofmt -l {CHANGED_FILES}"
+
+noop:
+  skip_if_no_changes: true
+  run:
+    - "gofmt -l {CHANGED_FILES}"
+    - "echo done"
+`
+
+func TestStartChangedFilesPlaceholder(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, changedFilesConfig)
+
+	process.On("Execute", "gofmt", "-l", "bar", "foo").Return([]byte(""), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	executor.Start([]string{"fmt"})
+}
+
+func TestStartChangedFilesPlaceholderSkipsWhenEmpty(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, changedFilesConfig)
+
+	process.On("Execute", "echo", "done").Return([]byte("done"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	executor.Start([]string{"noop"})
+
+	process.AssertNotCalled(t, "Execute", "gofmt", "-l")
+}
+
+const inputsConfig = `
+build:
+  files: [cmd/cli/*]
+  run:
+    - "echo 'build'"
+`
+
+func TestStartRecordsInputsOnSuccess(t *testing.T) {
+	verboseOpts := Options{NoCache: true, Verbose: true}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &verboseOpts, inputsConfig)
+
+	process.On("Execute", "echo", "build").Return(nil, nil, exitError(t, 2, "boom")).Once()
+	process.On("Execute", "echo", "build").Return([]byte("build"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 2).Return().Once()
+	process.On("Exit", 0).Return().Once()
+
+	// A failed run isn't recorded, so the task runs again.
+	ctx := context.Background()
+	listener := &recordingListener{}
+	for i := 0; i < 3; i++ {
+		executor := NewExecutor(parser, lockfile, &verboseOpts, process, fsMock, &ctx)
+		executor.AddListener(listener)
+		executor.Start([]string{"build"})
+	}
+
+	messages := []string{}
+	for _, event := range listener.events {
+		if event.Type == EventMessage {
+			messages = append(messages, event.Message)
+		}
+	}
+
+	require.Equal(t, []string{
+		"Running 'build': no previous successful run",
+		"Running 'build': no previous successful run",
+	}, messages)
+	process.AssertNumberOfCalls(t, "Execute", 2)
+}
+
+const probeConfig = `
+build:
+  inputs:
+    env: [GOKE_TEST_TARGET]
+    commands: ["go version"]
+  run:
+    - "echo 'build'"
+`
+
+func TestStartRunsAgainWhenInputsChange(t *testing.T) {
+	verboseOpts := Options{NoCache: true, Verbose: true}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &verboseOpts, probeConfig)
+
+	process.On("Execute", "go", "version").Return([]byte("go1.19\n"), nil, nil)
+	process.On("Execute", "echo", "build").Return([]byte("build"), nil, nil).Twice()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+	process.On("Exit", 0).Return().Once()
+
+	ctx := context.Background()
+	listener := &recordingListener{}
+	for _, target := range []string{"linux", "linux", "darwin"} {
+		t.Setenv("GOKE_TEST_TARGET", target)
+
+		executor := NewExecutor(parser, lockfile, &verboseOpts, process, fsMock, &ctx)
+		executor.AddListener(listener)
+		executor.Start([]string{"build"})
+	}
+
+	messages := []string{}
+	for _, event := range listener.events {
+		if event.Type == EventMessage {
+			messages = append(messages, event.Message)
+		}
+	}
+
+	require.Equal(t, []string{
+		"Running 'build': no previous successful run",
+		"Running 'build': $GOKE_TEST_TARGET changed",
+	}, messages)
+}
+
+func TestStartRunsWhenFileIsAddedWithParserCache(t *testing.T) {
+	var cache []byte
+	isParserCache := mock.MatchedBy(isParserCachePath)
+
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
+	fsMock.On("Getwd").Return("path/to/cwd", nil)
+	fsMock.On("FileExists", isParserCache).Return(func(string) bool { return cache != nil })
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("ReadFile", isParserCache).Return(func(string) []byte { return cache }, nil).Once()
+	fsMock.On("WriteFile", isParserCache, mock.Anything, os.FileMode(0600)).Run(func(args mock.Arguments) {
+		cache = args.Get(1).([]byte)
+	}).Return(nil).Once()
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil)
+	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{}, nil)
+	fsMock.On("Glob", isParserCache).Return([]string{}, nil).Once()
+	fsMock.On("Chtimes", isParserCache, mock.Anything, mock.Anything).Return(nil).Once()
+	fsMock.On("Glob", "cmd/cli/*").Return([]string{"cmd/cli/main.go"}, nil).Once()
+	fsMock.On("Glob", "cmd/cli/*").Return([]string{"cmd/cli/main.go", "cmd/cli/new.go"}, nil).Once()
+
+	process := tests.NewProcess(t)
+	process.On("Execute", "echo", "build").Return([]byte("build"), nil, nil).Twice()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	verboseOpts := Options{Verbose: true}
+	lockfile := NewLockfile(&verboseOpts, fsMock)
+	lockfile.Bootstrap()
+
+	// The second invocation uses the parser cache written by the first one.
+	ctx := context.Background()
+	listener := &recordingListener{}
+	for i := 0; i < 2; i++ {
+		parser := NewParser(inputsConfig, &verboseOpts, fsMock)
+		parser.Bootstrap()
+
+		executor := NewExecutor(&parser, &lockfile, &verboseOpts, process, fsMock, &ctx)
+		executor.AddListener(listener)
+		executor.Start([]string{"build"})
+	}
+
+	messages := []string{}
+	for _, event := range listener.events {
+		if event.Type == EventMessage {
+			messages = append(messages, event.Message)
+		}
+	}
+
+	require.Equal(t, []string{
+		"Running 'build': no previous successful run",
+		"Running 'build': cmd/cli/new.go was added",
+	}, messages)
+}
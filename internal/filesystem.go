@@ -8,6 +8,10 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/gofrs/flock"
 )
 
 type FileSystem interface {
@@ -17,8 +21,10 @@ type FileSystem interface {
 	Stat(name string) (fs.FileInfo, error)
 	FileExists(filename string) bool
 	Remove(name string) error
-	TempDir() string
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+	UserCacheDir() (string, error)
 	Glob(path string) ([]string, error)
+	Lock(name string) (func() error, error)
 }
 
 type LocalFileSystem struct{}
@@ -27,12 +33,51 @@ func (fs *LocalFileSystem) ReadFile(name string) ([]byte, error) {
 	return os.ReadFile(name)
 }
 
+// Writes the data to a temporary file next to the given one first, which then
+// replaces it. Readers never see a partially written file, even after a crash.
+// Missing parent directories are created.
 func (fs *LocalFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
-	return os.WriteFile(name, data, perm)
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
 }
 
+// Returns the working directory with its symlinks resolved, so that
+// a project has the same directory no matter how it was reached.
 func (fs *LocalFileSystem) Getwd() (dir string, err error) {
-	return os.Getwd()
+	dir, err = os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(dir)
 }
 
 func (fs *LocalFileSystem) Stat(name string) (fs.FileInfo, error) {
@@ -43,8 +88,12 @@ func (fs *LocalFileSystem) Remove(name string) error {
 	return os.Remove(name)
 }
 
-func (fs *LocalFileSystem) TempDir() string {
-	return os.TempDir()
+func (fs *LocalFileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (fs *LocalFileSystem) UserCacheDir() (string, error) {
+	return os.UserCacheDir()
 }
 
 func (fs *LocalFileSystem) FileExists(filename string) bool {
@@ -55,6 +104,22 @@ func (fs *LocalFileSystem) FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
+// Returns the files matching the pattern, "**" matches any number of directories.
 func (fs *LocalFileSystem) Glob(path string) ([]string, error) {
-	return filepath.Glob(path)
+	return doublestar.FilepathGlob(path, doublestar.WithFilesOnly())
+}
+
+// Takes an exclusive lock on the file, creating it and its directory if needed, and
+// waits until other processes release it. The returned function releases the lock.
+func (fs *LocalFileSystem) Lock(name string) (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+
+	lock := flock.New(name)
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+
+	return lock.Unlock, nil
 }
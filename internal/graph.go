@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTaskGraph writes the tree of tasks invoked by the given root tasks.
+// When no roots are given, every task which isn't invoked by another task is used.
+func WriteTaskGraph(w io.Writer, p Parseable, roots []string, dot bool) error {
+	if len(roots) == 0 {
+		roots = graphRoots(p)
+	}
+
+	if dot {
+		return writeDotGraph(w, p, roots)
+	}
+
+	for _, root := range roots {
+		if _, err := fmt.Fprintln(w, root); err != nil {
+			return err
+		}
+
+		task, _ := p.GetTask(root)
+		if err := writeTreeBranch(w, p, task, "", map[string]bool{root: true}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindTaskCycles returns an error for every chain of tasks which ends up invoking itself.
+func FindTaskCycles(p Parseable) []error {
+	var cycles []error
+	visited := make(map[string]bool)
+
+	var visit func(task Task, chain []string)
+	visit = func(task Task, chain []string) {
+		for i, name := range chain {
+			if name == task.Name {
+				cycle := append(append([]string{}, chain[i:]...), task.Name)
+				cycles = append(cycles, fmt.Errorf("cyclic task reference: %s", strings.Join(cycle, " -> ")))
+				return
+			}
+		}
+
+		if visited[task.Name] {
+			return
+		}
+
+		chain = append(chain, task.Name)
+		for _, dep := range taskDependencies(p, task) {
+			depTask, _ := p.GetTask(dep)
+			visit(depTask, chain)
+		}
+		visited[task.Name] = true
+	}
+
+	for _, task := range p.GetTasks() {
+		visit(task, nil)
+	}
+
+	return cycles
+}
+
+// Returns all tasks which are not invoked by any other task.
+// Falls back to all tasks when every task is invoked by another one.
+func graphRoots(p Parseable) []string {
+	invoked := make(map[string]bool)
+	for _, task := range p.GetTasks() {
+		for _, dep := range taskDependencies(p, task) {
+			invoked[dep] = true
+		}
+	}
+
+	var roots, all []string
+	for _, task := range p.GetTasks() {
+		all = append(all, task.Name)
+		if !invoked[task.Name] {
+			roots = append(roots, task.Name)
+		}
+	}
+
+	if len(roots) == 0 {
+		return all
+	}
+
+	return roots
+}
+
+// Recursively writes the dependencies of the task as an indented tree.
+func writeTreeBranch(w io.Writer, p Parseable, task Task, indent string, ancestors map[string]bool) error {
+	deps := taskDependencies(p, task)
+
+	for i, dep := range deps {
+		connector, childIndent := "├── ", indent+"│   "
+		if i == len(deps)-1 {
+			connector, childIndent = "└── ", indent+"    "
+		}
+
+		if ancestors[dep] {
+			if _, err := fmt.Fprintf(w, "%s%s%s (cycle)\n", indent, connector, dep); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s%s\n", indent, connector, dep); err != nil {
+			return err
+		}
+
+		ancestors[dep] = true
+		depTask, _ := p.GetTask(dep)
+		if err := writeTreeBranch(w, p, depTask, childIndent, ancestors); err != nil {
+			return err
+		}
+		delete(ancestors, dep)
+	}
+
+	return nil
+}
+
+// Writes every edge reachable from the roots in Graphviz DOT format.
+func writeDotGraph(w io.Writer, p Parseable, roots []string) error {
+	var b strings.Builder
+	visited := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+
+		task, _ := p.GetTask(name)
+		deps := taskDependencies(p, task)
+		if len(deps) == 0 {
+			b.WriteString(fmt.Sprintf("  %q;\n", name))
+		}
+
+		for _, dep := range deps {
+			b.WriteString(fmt.Sprintf("  %q -> %q;\n", name, dep))
+			visit(dep)
+		}
+	}
+
+	for _, root := range roots {
+		visit(root)
+	}
+
+	_, err := fmt.Fprintf(w, "digraph goke {\n%s}\n", b.String())
+	return err
+}
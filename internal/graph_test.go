@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dugajean/goke/internal/tests"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const cyclicConfigStub = `
+loopa:
+  run: ["loopb"]
+
+loopb:
+  run: ["loopa"]
+`
+
+func TestWriteTaskGraph(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteTaskGraph(&out, getListingParser(t), []string{"greet-cats"}, false)
+
+	require.Nil(t, err)
+	require.Equal(t, "greet-cats\n└── greet-loki\n", out.String())
+}
+
+func TestWriteTaskGraphDot(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteTaskGraph(&out, getListingParser(t), []string{"greet-cats"}, true)
+
+	require.Nil(t, err)
+	require.Equal(t, "digraph goke {\n  \"greet-cats\" -> \"greet-loki\";\n  \"greet-loki\";\n}\n", out.String())
+}
+
+func TestFindTaskCycles(t *testing.T) {
+	require.Empty(t, FindTaskCycles(getListingParser(t)))
+
+	fsMock := mockCacheDoesNotExist(t)
+	fsMock.On("Glob", mock.Anything).Return(tests.ExpectedGlob, nil).Maybe()
+
+	parser := NewParser(cyclicConfigStub, &clearCacheOpts, fsMock)
+	require.Nil(t, parser.parseTasks())
+
+	cycles := FindTaskCycles(parser)
+	require.Len(t, cycles, 1)
+	require.Equal(t, "cyclic task reference: loopa -> loopb -> loopa", cycles[0].Error())
+}
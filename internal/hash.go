@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The deterministic fingerprint of the resolved inputs of a task and the
+// tasks it invokes, e.g. for keying CI caches off the same inputs as goke.
+type TaskHash struct {
+	Task         string            `json:"task"`
+	Hash         string            `json:"hash"`
+	Files        map[string]string `json:"files"`
+	Dependencies []string          `json:"dependencies"`
+}
+
+// Computes the hash of the task out of its commands, environment, inputs and the
+// contents of its files, and of the tasks it invokes. Probe commands of the inputs
+// are run, but neither the task nor the lockfile are touched.
+func (e *Executor) TaskHash(task Task) (TaskHash, error) {
+	hash := TaskHash{Task: task.Name, Files: make(map[string]string), Dependencies: []string{}}
+	seen := map[string]bool{task.Name: true}
+
+	lines, err := e.hashLines(task, &hash, seen)
+	if err != nil {
+		return TaskHash{}, err
+	}
+
+	sort.Strings(hash.Dependencies)
+	hash.Hash = fingerprint(strings.Join(lines, "\n"))
+
+	return hash, nil
+}
+
+// Returns the lines describing the inputs of the task, followed by the ones of the tasks it invokes.
+// Every task is only described once, even if invoked from several places or in a cycle.
+func (e *Executor) hashLines(task Task, hash *TaskHash, seen map[string]bool) ([]string, error) {
+	referenced := referencedVariables(task)
+
+	task, err := e.expandTask(task)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{"task " + task.Name}
+
+	// The commands as they run, with the variables they refer to expanded.
+	for _, cmd := range task.Run {
+		lines = append(lines, "run "+os.ExpandEnv(cmd))
+	}
+
+	for _, k := range sortedKeys(task.Env) {
+		lines = append(lines, fmt.Sprintf("env %s %s", k, fingerprint(task.Env[k])))
+	}
+
+	global := e.parser.GetGlobal().Shared.Env
+	for _, k := range referenced {
+		if value, ok := global[k]; ok {
+			lines = append(lines, fmt.Sprintf("global %s %s", k, fingerprint(value)))
+		}
+	}
+
+	inputs, err := e.inputFingerprints(task)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range sortedKeys(inputs) {
+		lines = append(lines, fmt.Sprintf("input %s %s", k, inputs[k]))
+	}
+
+	for _, f := range task.Files {
+		contents, err := e.fs.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Files[f] = fingerprint(string(contents))
+		lines = append(lines, fmt.Sprintf("file %s %s", f, hash.Files[f]))
+	}
+
+	for _, dep := range taskDependencies(e.parser, task) {
+		if seen[dep] {
+			continue
+		}
+
+		seen[dep] = true
+		hash.Dependencies = append(hash.Dependencies, dep)
+
+		depTask, _ := e.parser.GetTask(dep)
+		depLines, err := e.hashLines(depTask, hash, seen)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, depLines...)
+	}
+
+	return lines, nil
+}
+
+// Returns the sorted names of the environment variables the commands and the files of
+// the task refer to, either as $NAME, ${NAME} or $(NAME).
+func referencedVariables(task Task) []string {
+	names := []string{}
+	values := append(append([]string{}, task.Run...), task.Files...)
+
+	for _, v := range values {
+		os.Expand(v, func(name string) string {
+			names = append(names, name)
+			return ""
+		})
+
+		for _, match := range osCommandRegexp.FindAllStringSubmatch(v, -1) {
+			names = append(names, match[1])
+		}
+	}
+
+	return uniqueSorted(names)
+}
+
+// JSON returns the indented JSON representation of the hash.
+func (th TaskHash) JSON() (string, error) {
+	b, err := json.MarshalIndent(th, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const hashConfig = `
+build:
+  files: [cmd/cli/*]
+  inputs:
+    env: [GOKE_TEST_TARGET]
+  run:
+    - "echo 'build'"
+    - "greet"
+
+greet:
+  run:
+    - "echo 'hello'"
+    - "build"
+`
+
+func TestTaskHash(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, hashConfig)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	task, _ := (*parser).GetTask("build")
+
+	t.Setenv("GOKE_TEST_TARGET", "linux")
+	hash, err := executor.TaskHash(task)
+	require.Nil(t, err)
+
+	again, err := executor.TaskHash(task)
+	require.Nil(t, err)
+	require.Equal(t, hash, again)
+
+	require.Equal(t, []string{"greet"}, hash.Dependencies)
+	require.Equal(t, map[string]string{"bar": fingerprint(dotGokeFile), "foo": fingerprint(dotGokeFile)}, hash.Files)
+	require.Len(t, hash.Hash, 64)
+
+	t.Setenv("GOKE_TEST_TARGET", "darwin")
+	changed, err := executor.TaskHash(task)
+	require.Nil(t, err)
+	require.NotEqual(t, hash.Hash, changed.Hash)
+}
+
+const hashGlobalEnvConfig = `
+global:
+  environment:
+    GOKE_TEST_VERSION: "%s"
+    GOKE_TEST_UNUSED: "%s"
+
+release:
+  run:
+    - "echo ${GOKE_TEST_VERSION}"
+`
+
+func TestTaskHashUsesGlobalEnvironment(t *testing.T) {
+	t.Setenv("GOKE_TEST_VERSION", "")
+	t.Setenv("GOKE_TEST_UNUSED", "")
+
+	hashFor := func(version, unused string) string {
+		config := fmt.Sprintf(hashGlobalEnvConfig, version, unused)
+		parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, config)
+
+		ctx := context.Background()
+		executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+		task, _ := (*parser).GetTask("release")
+
+		hash, err := executor.TaskHash(task)
+		require.Nil(t, err)
+
+		return hash.Hash
+	}
+
+	hash := hashFor("1.0", "a")
+	require.Equal(t, hash, hashFor("1.0", "b"))
+	require.NotEqual(t, hash, hashFor("1.1", "a"))
+}
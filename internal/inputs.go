@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The prefixes of the keys under which the inputs of a task are recorded.
+const (
+	inputEnvPrefix     = "env:"
+	inputCommandPrefix = "cmd:"
+)
+
+// Recorded for environment variables which aren't set, so that unsetting a variable
+// is told apart from setting it to an empty string.
+const unsetEnvFingerprint = "unset"
+
+// Whether the task has anything which decides if it's up-to-date.
+func (t Task) hasInputs() bool {
+	return len(t.Files) > 0 || len(t.Inputs.Env) > 0 || len(t.Inputs.Commands) > 0
+}
+
+// Returns the fingerprints of the non-file inputs of the task, by input key.
+// Only hashes of the values are kept, so that no secrets end up in the lockfile.
+func (e *Executor) inputFingerprints(task Task) (map[string]string, error) {
+	fingerprints := make(map[string]string)
+
+	for _, name := range task.Inputs.Env {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			fingerprints[inputEnvPrefix+name] = unsetEnvFingerprint
+			continue
+		}
+
+		fingerprints[inputEnvPrefix+name] = fingerprint(value)
+	}
+
+	for _, probe := range task.Inputs.Commands {
+		outputs := make(chan Ref[CommandOutput])
+		go e.runSysCommand(probe, nil, false, outputs)
+		out := <-outputs
+
+		if out.Error() != nil {
+			return nil, fmt.Errorf("input command '%s' of task '%s' failed: %w", probe, task.Name, out.Error())
+		}
+
+		fingerprints[inputCommandPrefix+probe] = fingerprint(strings.TrimSpace(out.Value().Stdout))
+	}
+
+	return fingerprints, nil
+}
+
+// Returns the hex encoded SHA-256 hash of the value.
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the fingerprint of the commands of the task.
+func commandsFingerprint(task Task) string {
+	return fingerprint(strings.Join(task.Run, "\n"))
+}
+
+// Returns the first characters of the fingerprint, which are enough to tell fingerprints apart.
+func shortFingerprint(value string) string {
+	if value == "" {
+		return "none"
+	}
+
+	if len(value) > 12 {
+		return value[:12]
+	}
+
+	return value
+}
+
+// Returns the inputs whose fingerprints differ, including the ones which were added or removed.
+func changedInputs(recorded map[string]string, current map[string]string) []InputChange {
+	changed := []InputChange{}
+
+	for key, value := range current {
+		if recordedValue := recorded[key]; recordedValue != value {
+			changed = append(changed, InputChange{Input: key, Old: recordedValue, New: value})
+		}
+	}
+
+	for key, recordedValue := range recorded {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, InputChange{Input: key, Old: recordedValue})
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[i].Input < changed[j].Input
+	})
+
+	return changed
+}
+
+// Describes the input for the user, e.g. "$GOOS" or "the output of 'go version'".
+func describeInput(key string) string {
+	if strings.HasPrefix(key, inputEnvPrefix) {
+		return "$" + strings.TrimPrefix(key, inputEnvPrefix)
+	}
+
+	return fmt.Sprintf("the output of '%s'", strings.TrimPrefix(key, inputCommandPrefix))
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// The version of the JSON task listing schema. Bump it whenever
+// a field is renamed or removed, adding fields is backwards compatible.
+const TaskListingVersion = 1
+
+type TaskListing struct {
+	Version int              `json:"version"`
+	Config  string           `json:"config"`
+	Tasks   []TaskListingRow `json:"tasks"`
+}
+
+type TaskListingRow struct {
+	Name   string            `json:"name"`
+	Desc   string            `json:"desc"`
+	Files  []string          `json:"files"`
+	Run    []string          `json:"run"`
+	Deps   []string          `json:"deps"`
+	Env    []string          `json:"env"`
+	Source TaskListingSource `json:"source"`
+}
+
+type TaskListingSource struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// NewTaskListing builds the machine-readable listing of all tasks known to the parser,
+// along with the files their patterns currently match.
+func NewTaskListing(p Parseable) (TaskListing, error) {
+	configFile := CurrentConfigFile()
+	listing := TaskListing{
+		Version: TaskListingVersion,
+		Config:  configFile,
+		Tasks:   []TaskListingRow{},
+	}
+
+	for _, task := range p.GetTasks() {
+		task, err := p.ExpandTask(task)
+		if err != nil {
+			return listing, err
+		}
+
+		listing.Tasks = append(listing.Tasks, TaskListingRow{
+			Name:   task.Name,
+			Desc:   task.Desc,
+			Files:  nonNilSlice(task.Files),
+			Run:    nonNilSlice(task.Run),
+			Deps:   taskDependencies(p, task),
+			Env:    sortedKeys(task.Env),
+			Source: TaskListingSource{File: configFile, Line: task.Line},
+		})
+	}
+
+	return listing, nil
+}
+
+// JSON returns the indented JSON representation of the listing.
+func (tl TaskListing) JSON() (string, error) {
+	b, err := json.MarshalIndent(tl, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Returns the names of the tasks which are invoked from the "run" section of the given task.
+func taskDependencies(p Parseable, task Task) []string {
+	deps := []string{}
+	seen := make(map[string]bool)
+
+	for _, cmd := range task.Run {
+		if _, ok := p.GetTask(cmd); ok && !seen[cmd] {
+			seen[cmd] = true
+			deps = append(deps, cmd)
+		}
+	}
+
+	return deps
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func nonNilSlice(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/dugajean/goke/internal/tests"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func getListingParser(t *testing.T) Parseable {
+	fsMock := mockCacheDoesNotExist(t)
+	fsMock.On("Glob", mock.Anything).Return(tests.ExpectedGlob, nil).Maybe()
+
+	parser := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock)
+	require.Nil(t, parser.parseTasks())
+
+	return parser
+}
+
+func TestTaskListing(t *testing.T) {
+	listing, err := NewTaskListing(getListingParser(t))
+	require.Nil(t, err)
+
+	require.Equal(t, TaskListingVersion, listing.Version)
+
+	rows := make(map[string]TaskListingRow)
+	names := []string{}
+	for _, row := range listing.Tasks {
+		rows[row.Name] = row
+		names = append(names, row.Name)
+	}
+	require.IsIncreasing(t, names)
+
+	greetCats := rows["greet-cats"]
+	require.Equal(t, []string{"bar", "foo"}, greetCats.Files) // sorted
+	require.Equal(t, []string{"greet-loki"}, greetCats.Deps)
+	require.Equal(t, 29, greetCats.Source.Line)
+
+	greetLisha := rows["greet-lisha"]
+	require.Equal(t, "Greets Lisha", greetLisha.Desc)
+	require.Equal(t, []string{}, greetLisha.Deps)
+
+	greetThor := rows["greet-thor"]
+	require.Equal(t, []string{"THOR"}, greetThor.Env)
+}
+
+func TestTaskListingJSON(t *testing.T) {
+	listing, err := NewTaskListing(getListingParser(t))
+	require.Nil(t, err)
+
+	out, err := listing.JSON()
+	require.Nil(t, err)
+
+	var decoded map[string]any
+	require.Nil(t, json.Unmarshal([]byte(out), &decoded))
+	require.Equal(t, float64(TaskListingVersion), decoded["version"])
+	require.NotEmpty(t, decoded["tasks"])
+}
+
+func TestTaskListingLeavesEnvUnresolved(t *testing.T) {
+	config := `
+global:
+  environment:
+    LISTING_GLOBAL: "$(echo global)"
+
+deploy:
+  env:
+    LISTING_TOKEN: "$(echo s3cret)"
+  run:
+    - "deploy"
+`
+
+	parser := NewParser(config, &clearCacheOpts, mockCacheDoesNotExist(t))
+	require.Nil(t, parser.parseTasks())
+
+	listing, err := NewTaskListing(parser)
+	require.Nil(t, err)
+	require.Equal(t, []string{"LISTING_TOKEN"}, listing.Tasks[0].Env)
+
+	_, ok := os.LookupEnv("LISTING_GLOBAL")
+	require.False(t, ok)
+	_, ok = os.LookupEnv("LISTING_TOKEN")
+	require.False(t, ok)
+}
@@ -2,141 +2,538 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"os/user"
+	"os"
 	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The version of the lockfile format. Lockfiles without a version are
+// of the legacy format, which only kept one set of mtimes per project.
+const LockfileVersion = 2
+
+// The ways in which an input file of a task can change between runs.
+// A renamed file is reported as removed under its old name, and added under the new one.
+const (
+	FileAdded    = "added"
+	FileRemoved  = "removed"
+	FileModified = "modified"
 )
 
 type (
-	singleProjectJson map[string]int64
-	lockFileJson      map[string]singleProjectJson
+	// The mtimes of the files, by path.
+	fileModTimes map[string]int64
+
+	taskLockJson struct {
+		Files fileModTimes `json:"files"`
+
+		// The fingerprints of the environment variables and probe commands, by input key.
+		Inputs map[string]string `json:"inputs,omitempty"`
+
+		// The fingerprint of the commands of the task.
+		Commands string `json:"commands,omitempty"`
+	}
+
+	singleProjectJson struct {
+		Tasks map[string]taskLockJson `json:"tasks"`
+
+		// The mtimes of a legacy lockfile, consulted for tasks which didn't run since.
+		LegacyFiles fileModTimes `json:"legacy_files,omitempty"`
+
+		// When goke last ran in the project, as a unix timestamp.
+		LastUsed int64 `json:"last_used,omitempty"`
+	}
+
+	lockFileJson struct {
+		Version  int                           `json:"version"`
+		Projects map[string]*singleProjectJson `json:"projects"`
+	}
 )
 
+// A change to one of the input files of a task, along with the recorded
+// and the current mtime. The mtime is 0 for files which don't exist.
+type FileChange struct {
+	File string `json:"file"`
+	Kind string `json:"kind"`
+	Old  int64  `json:"old_mtime,omitempty"`
+	New  int64  `json:"new_mtime,omitempty"`
+}
+
+// A change to an environment variable or probe command of a task, along with the
+// recorded and the current fingerprint. Fingerprints are empty for inputs which
+// were added to or removed from the task.
+type InputChange struct {
+	Input string `json:"input"`
+	Old   string `json:"old_fingerprint,omitempty"`
+	New   string `json:"new_fingerprint,omitempty"`
+}
+
+// Describes whether the inputs of a task changed since its last successful run.
+type Staleness struct {
+	NeverRan bool
+	Changes  []FileChange
+
+	// The non-file inputs whose values changed.
+	ChangedInputs []InputChange
+
+	// Whether the commands of the task changed.
+	CommandsChanged bool
+
+	// The inputs as they are now, recorded once the task succeeds.
+	current         fileModTimes
+	currentInputs   map[string]string
+	currentCommands string
+}
+
+// Whether the task has to run again.
+func (s Staleness) Stale() bool {
+	return s.NeverRan || len(s.Changes) > 0 || len(s.ChangedInputs) > 0 || s.CommandsChanged
+}
+
+// Returns the files which were added or modified, the ones the task still has to look at.
+func (s Staleness) ChangedFiles() []string {
+	changed := []string{}
+	for _, c := range s.Changes {
+		if c.Kind != FileRemoved {
+			changed = append(changed, c.File)
+		}
+	}
+
+	return changed
+}
+
+// Describes the reason for running the task, e.g. "main.go was modified".
+func (s Staleness) Reason() string {
+	if s.NeverRan {
+		return "no previous successful run"
+	}
+
+	reasons := []string{}
+	for _, c := range s.Changes {
+		reasons = append(reasons, fmt.Sprintf("%s was %s", c.File, c.Kind))
+	}
+
+	for _, c := range s.ChangedInputs {
+		reasons = append(reasons, fmt.Sprintf("%s changed", describeInput(c.Input)))
+	}
+
+	if s.CommandsChanged {
+		reasons = append(reasons, "the commands changed")
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+// Describes every reason for running the task in detail, including the recorded and current values.
+func (s Staleness) Details() []string {
+	if s.NeverRan {
+		return []string{"no previous successful run is recorded"}
+	}
+
+	details := []string{}
+	for _, c := range s.Changes {
+		switch c.Kind {
+		case FileModified:
+			details = append(details, fmt.Sprintf("%s was modified (mtime %s -> %s)", c.File, formatMtime(c.Old), formatMtime(c.New)))
+		case FileAdded:
+			details = append(details, fmt.Sprintf("%s was added (mtime %s)", c.File, formatMtime(c.New)))
+		default:
+			details = append(details, fmt.Sprintf("%s was removed (recorded mtime %s)", c.File, formatMtime(c.Old)))
+		}
+	}
+
+	for _, c := range s.ChangedInputs {
+		details = append(details, fmt.Sprintf("%s changed (fingerprint %s -> %s)", describeInput(c.Input), shortFingerprint(c.Old), shortFingerprint(c.New)))
+	}
+
+	if s.CommandsChanged {
+		details = append(details, "the commands changed")
+	}
+
+	return details
+}
+
+// Whether the input files are the same as when the other staleness was determined.
+func (s Staleness) sameInputs(other Staleness) bool {
+	if len(s.current) != len(other.current) {
+		return false
+	}
+
+	for f, mtime := range s.current {
+		if otherMtime, ok := other.current[f]; !ok || otherMtime != mtime {
+			return false
+		}
+	}
+
+	return len(changedInputs(s.currentInputs, other.currentInputs)) == 0
+}
+
+// Formats the mtime of a file as recorded in the lockfile.
+func formatMtime(mtime int64) string {
+	return time.Unix(mtime, 0).Format("2006-01-02 15:04:05")
+}
+
 type Lockfile struct {
-	files   []string
 	JSON    lockFileJson
 	options Options
 	fs      FileSystem
+
+	// Whether the user was warned about a corrupt lockfile already.
+	warnedCorrupt bool
 }
 
-func NewLockfile(files []string, opts *Options, fs FileSystem) Lockfile {
+func NewLockfile(opts *Options, fs FileSystem) Lockfile {
 	return Lockfile{
-		files:   files,
 		options: *opts,
 		fs:      fs,
 	}
 }
 
-// Loads existing lock information generates it for the first time.
+// Loads the existing lock information, migrating it from the legacy format.
+// Nothing is written until a task succeeds.
 func (l *Lockfile) Bootstrap() {
-	lockfilePath, err := l.getLockfilePath()
-	if err != nil && !l.options.Quiet {
+	l.JSON = lockFileJson{Version: LockfileVersion, Projects: make(map[string]*singleProjectJson)}
+
+	if err := l.reload(); err != nil && !l.options.Quiet {
 		log.Fatal(err)
 	}
+}
+
+// Replaces the lock information with the contents of the lockfile, if it exists.
+// A corrupt lockfile, e.g. after a crash, is ignored with a warning and replaced
+// on the next write.
+func (l *Lockfile) reload() error {
+	lockfilePath, err := l.getLockfilePath()
+	if err != nil {
+		return err
+	}
+
+	if !l.fs.FileExists(lockfilePath) && l.options.StateDir == "" {
+		// Taken over from the legacy location, the next write goes to the state directory.
+		lockfilePath, err = legacyLockfilePath()
+		if err != nil {
+			return err
+		}
+	}
 
 	if !l.fs.FileExists(lockfilePath) {
-		l.generateLockfile(true)
+		return nil
 	}
 
-	currentLockFile, err := l.fs.ReadFile(lockfilePath)
-	if err != nil && !l.options.Quiet {
-		log.Fatal(err)
+	contents, err := l.fs.ReadFile(lockfilePath)
+	if err != nil {
+		return err
 	}
 
-	err = json.Unmarshal(currentLockFile, &l.JSON)
-	if err != nil && !l.options.Quiet {
-		log.Fatal(err)
+	loaded, err := parseLockfile(contents)
+	if errors.Is(err, errNewerLockfile) {
+		return err
+	}
+
+	if err != nil {
+		if !l.options.Quiet && !l.warnedCorrupt {
+			l.warnedCorrupt = true
+			log.Printf("Warning: ignoring the corrupt lockfile %s: %s", lockfilePath, err)
+		}
+
+		loaded = lockFileJson{Projects: make(map[string]*singleProjectJson)}
 	}
+
+	// The map is shared with the copies of the lockfile, so it's refilled instead of replaced.
+	for dir := range l.JSON.Projects {
+		delete(l.JSON.Projects, dir)
+	}
+
+	for dir, project := range loaded.Projects {
+		l.JSON.Projects[dir] = project
+	}
+
+	return nil
 }
 
-// Returns the lock information for the current project.
-func (l *Lockfile) GetCurrentProject() singleProjectJson {
-	cwd, _ := l.fs.Getwd()
-	return l.JSON[cwd]
+// Returned for lockfiles of a format this version of goke doesn't know.
+var errNewerLockfile = errors.New("the lockfile was written by a newer version of goke")
+
+// Parses the contents of a lockfile, migrating them from the legacy format.
+func parseLockfile(contents []byte) (lockFileJson, error) {
+	parsed := lockFileJson{Version: LockfileVersion, Projects: make(map[string]*singleProjectJson)}
+
+	var version struct {
+		Version int `json:"version"`
+	}
+
+	if err := json.Unmarshal(contents, &version); err != nil {
+		return parsed, err
+	}
+
+	if version.Version == 0 {
+		var legacy map[string]fileModTimes
+		if err := json.Unmarshal(contents, &legacy); err != nil {
+			return parsed, err
+		}
+
+		for cwd, files := range legacy {
+			parsed.Projects[cwd] = &singleProjectJson{Tasks: make(map[string]taskLockJson), LegacyFiles: files}
+		}
+
+		return parsed, nil
+	}
+
+	if version.Version > LockfileVersion {
+		return parsed, fmt.Errorf("%w (format %d)", errNewerLockfile, version.Version)
+	}
+
+	if err := json.Unmarshal(contents, &parsed); err != nil {
+		return parsed, err
+	}
+
+	if parsed.Projects == nil {
+		parsed.Projects = make(map[string]*singleProjectJson)
+	}
+
+	for _, project := range parsed.Projects {
+		if project.Tasks == nil {
+			project.Tasks = make(map[string]taskLockJson)
+		}
+	}
+
+	return parsed, nil
 }
 
-// Update timestamps for files in current project.
-func (l *Lockfile) UpdateTimestampsForFiles(files []string) error {
-	lockfileMap, err := l.prepareMap(files)
+// Applies the change on top of the current contents of the lockfile and writes
+// it, holding a lock on it all along. This way goke processes running at the
+// same time, e.g. in watch mode and in another terminal, keep each other's changes.
+func (l *Lockfile) update(change func() error) error {
+	lockfilePath, err := l.getLockfilePath()
 	if err != nil {
 		return err
 	}
 
-	cwd, err := l.fs.Getwd()
+	unlock, err := l.fs.Lock(lockfilePath + ".lock")
 	if err != nil {
 		return err
 	}
 
-	l.JSON[cwd] = lockfileMap
-	for f := range l.JSON[cwd] {
-		l.JSON[cwd][f] = lockfileMap[f]
+	defer unlock()
+
+	if err := l.reload(); err != nil {
+		return err
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	return l.writeLockfile()
+}
+
+// Returns the lock information for the current project, creating it if needed.
+func (l *Lockfile) currentProject() (*singleProjectJson, error) {
+	key, err := projectKey(l.options, l.fs)
+	if err != nil {
+		return nil, err
+	}
+
+	project, ok := l.JSON.Projects[key]
+	if !ok {
+		project = &singleProjectJson{Tasks: make(map[string]taskLockJson)}
+		l.JSON.Projects[key] = project
 	}
 
-	err = l.generateLockfile(false)
+	return project, nil
+}
+
+// Removes the lock information of the current project.
+func (l *Lockfile) ClearCurrentProject() error {
+	key, err := projectKey(l.options, l.fs)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return l.update(func() error {
+		delete(l.JSON.Projects, key)
+		return nil
+	})
 }
 
-// Generate the lockfile file, or update it with new contents.
-func (l *Lockfile) generateLockfile(initialLockfile bool) error {
-	contents := l.JSON
-	if initialLockfile {
-		lockfileMap, err := l.prepareMap(l.files)
+// Records that goke ran in the current project, for "goke cache prune".
+func (l *Lockfile) MarkUsed() error {
+	return l.update(func() error {
+		project, err := l.currentProject()
 		if err != nil {
 			return err
 		}
 
-		cwd, _ := l.fs.Getwd()
-		contents = lockFileJson{cwd: lockfileMap}
+		project.LastUsed = time.Now().Unix()
+		return nil
+	})
+}
+
+// Removes the lock information of a single task of the current project,
+// so that it runs the next time. Returns false if nothing was recorded for it.
+func (l *Lockfile) InvalidateTask(taskName string) (bool, error) {
+	recorded := false
+
+	err := l.update(func() error {
+		project, err := l.currentProject()
+		if err != nil {
+			return err
+		}
+
+		_, recorded = project.Tasks[taskName]
+		delete(project.Tasks, taskName)
+
+		// An empty record keeps the legacy mtimes from making the task up-to-date again.
+		if len(project.LegacyFiles) > 0 {
+			recorded = true
+			project.Tasks[taskName] = taskLockJson{}
+		}
+
+		return nil
+	})
+
+	return recorded, err
+}
+
+// Compares the input files and the fingerprints of the other inputs
+// of the task with the ones recorded for its last successful run.
+func (l *Lockfile) Staleness(task Task, inputs map[string]string) (Staleness, error) {
+	project, err := l.currentProject()
+	if err != nil {
+		return Staleness{}, err
 	}
 
-	jsonString, err := json.MarshalIndent(contents, "", "  ")
+	stalenessCh := make(chan Ref[Staleness])
+	go l.stalenessRoutine(task, inputs, project, stalenessCh)
+	staleness := <-stalenessCh
+
+	return staleness.Value(), staleness.Error()
+}
+
+// Records the input files of a task which succeeded, as they were before it ran.
+func (l *Lockfile) RecordTask(task Task, staleness Staleness) error {
+	return l.update(func() error {
+		project, err := l.currentProject()
+		if err != nil {
+			return err
+		}
+
+		project.LastUsed = time.Now().Unix()
+		project.Tasks[task.Name] = taskLockJson{
+			Files:    staleness.current,
+			Inputs:   staleness.currentInputs,
+			Commands: staleness.currentCommands,
+		}
+
+		return nil
+	})
+}
+
+// Go routine which stats the input files of the task, and collects the
+// files which were added, removed or modified since the recorded run.
+func (l *Lockfile) stalenessRoutine(task Task, inputs map[string]string, project *singleProjectJson, ch chan Ref[Staleness]) {
+	current, err := l.modTimes(task.Files)
 	if err != nil {
-		return err
+		ch <- NewRef(Staleness{}, err)
+		return
 	}
 
-	writeCh := make(chan error)
-	go l.writeLockfileRoutine(jsonString, writeCh)
+	staleness := Staleness{current: current, currentInputs: inputs, currentCommands: commandsFingerprint(task)}
+	recorded, ok := project.Tasks[task.Name]
 
-	if err = <-writeCh; err != nil {
-		return err
+	// The legacy format didn't record any other inputs.
+	if !ok && len(inputs) == 0 {
+		recorded, ok = project.legacyRecord(task.Files)
 	}
 
-	return nil
+	if !ok {
+		staleness.NeverRan = true
+		ch <- NewRef(staleness, nil)
+		return
+	}
+
+	for f, mtime := range current {
+		lockedMtime, ok := recorded.Files[f]
+		if !ok {
+			staleness.Changes = append(staleness.Changes, FileChange{File: f, Kind: FileAdded, New: mtime})
+		} else if lockedMtime != mtime {
+			staleness.Changes = append(staleness.Changes, FileChange{File: f, Kind: FileModified, Old: lockedMtime, New: mtime})
+		}
+	}
+
+	for f, lockedMtime := range recorded.Files {
+		if _, ok := current[f]; !ok {
+			staleness.Changes = append(staleness.Changes, FileChange{File: f, Kind: FileRemoved, Old: lockedMtime})
+		}
+	}
+
+	sort.Slice(staleness.Changes, func(i, j int) bool {
+		return staleness.Changes[i].File < staleness.Changes[j].File
+	})
+
+	staleness.ChangedInputs = changedInputs(recorded.Inputs, inputs)
+
+	// Records written before the commands were fingerprinted don't know about them.
+	staleness.CommandsChanged = recorded.Commands != "" && recorded.Commands != staleness.currentCommands
+
+	ch <- NewRef(staleness, nil)
 }
 
-// Prepares the map used to populate individual project files.
-func (l *Lockfile) prepareMap(files []string) (singleProjectJson, error) {
-	lockfileMapCh := make(chan Ref[singleProjectJson])
-	go l.getFileModifiedMapRoutine(files, lockfileMapCh)
+// Builds a record out of the legacy mtimes, if they cover every file of the task.
+// The legacy format only knew about files being newer than the recorded ones.
+func (p *singleProjectJson) legacyRecord(files []string) (taskLockJson, bool) {
+	if len(p.LegacyFiles) == 0 {
+		return taskLockJson{}, false
+	}
 
-	lockfileRef := <-lockfileMapCh
+	record := taskLockJson{Files: make(fileModTimes)}
+	for _, f := range files {
+		mtime, ok := p.LegacyFiles[f]
+		if !ok {
+			return taskLockJson{}, false
+		}
 
-	if lockfileRef.Error() != nil {
-		return nil, lockfileRef.Error()
+		record.Files[f] = mtime
 	}
 
-	return lockfileRef.Value(), nil
+	return record, true
 }
 
-// Go routine used to dispatch file mtime checks in the background.
-func (l *Lockfile) getFileModifiedMapRoutine(files []string, ch chan Ref[singleProjectJson]) {
-	lockfileMap := make(singleProjectJson)
+// Returns the mtimes of the files. Files which vanished since they were matched are left out.
+func (l *Lockfile) modTimes(files []string) (fileModTimes, error) {
+	modTimes := make(fileModTimes)
 
 	for _, f := range files {
 		fo, err := l.fs.Stat(f)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
 
 		if err != nil {
-			ch <- NewRef[singleProjectJson](nil, err)
+			return nil, err
 		}
 
-		lockfileMap[f] = fo.ModTime().Unix()
+		modTimes[f] = fo.ModTime().Unix()
 	}
 
-	ch <- NewRef(lockfileMap, nil)
+	return modTimes, nil
+}
+
+// Writes the lock information into the lockfile.
+func (l *Lockfile) writeLockfile() error {
+	jsonString, err := json.MarshalIndent(l.JSON, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	writeCh := make(chan error)
+	go l.writeLockfileRoutine(jsonString, writeCh)
+
+	return <-writeCh
 }
 
 // Writes the lockfile into the filesystem.
@@ -155,12 +552,12 @@ func (l *Lockfile) writeLockfileRoutine(contents []byte, ch chan error) {
 	ch <- nil
 }
 
-// Returns the location of the lockfile in the system.
+// Returns the location of the lockfile in the state directory.
 func (l *Lockfile) getLockfilePath() (string, error) {
-	user, err := user.Current()
+	dir, err := stateDir(l.options, l.fs)
 	if err != nil {
 		return "", err
 	}
 
-	return path.Join(user.HomeDir, ".goke"), nil
+	return path.Join(dir, lockfileName), nil
 }
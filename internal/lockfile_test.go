@@ -1,17 +1,20 @@
 package internal
 
 import (
+	"encoding/json"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/dugajean/goke/internal/tests"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-var files = []string{"./lockfile.go"}
-
 var lockfileOpts = Options{
-	NoCache: true,
+	NoCache:  true,
+	StateDir: "/path/to/state",
 }
 
 var dotGokeFile = `{
@@ -23,34 +26,249 @@ var dotGokeFile = `{
   }
 }`
 
+var lockedMtime = time.Unix(1664738433, 0)
+
+// Stands in for releasing the lock on the lockfile.
+func unlock() error {
+	return nil
+}
+
 func TestNewLockfile(t *testing.T) {
 	fsMock := tests.NewFileSystem(t)
-	lockfile := NewLockfile(files, &lockfileOpts, fsMock)
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
 
 	assert.NotNil(t, lockfile)
-	assert.Equal(t, files, lockfile.files)
+	assert.Equal(t, lockfileOpts, lockfile.options)
+}
+
+func TestBootstrapMigratesLegacyLockfile(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("FileExists", mock.Anything).Return(true)
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(dotGokeFile), nil)
+
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.Bootstrap()
+
+	require.Equal(t, LockfileVersion, lockfile.JSON.Version)
+	require.Contains(t, lockfile.JSON.Projects, "/path/to/project1")
+	require.Equal(t, fileModTimes{"path/to/file": 1664738433}, lockfile.JSON.Projects["/path/to/project1"].LegacyFiles)
+}
+
+func TestStalenessOfLegacyProject(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("UserCacheDir").Return("/home/me/.cache", nil)
+	fsMock.On("FileExists", mock.Anything).Return(true)
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(dotGokeFile), nil)
+	fsMock.On("Getwd").Return("/path/to/project1", nil)
+	fsMock.On("Stat", "path/to/file").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+	fsMock.On("Stat", "path/to/other").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+
+	// Legacy projects are only known to the default state directory.
+	lockfile := NewLockfile(&Options{NoCache: true}, fsMock)
+	lockfile.Bootstrap()
+
+	staleness, err := lockfile.Staleness(Task{Name: "build", Files: []string{"path/to/file"}}, nil)
+	require.Nil(t, err)
+	require.False(t, staleness.Stale())
+
+	// The legacy lockfile knows nothing about the other file.
+	staleness, err = lockfile.Staleness(Task{Name: "build", Files: []string{"path/to/file", "path/to/other"}}, nil)
+	require.Nil(t, err)
+	require.True(t, staleness.NeverRan)
+}
+
+func TestStalenessDetectsChangedInputs(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("Stat", "kept.go").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+	fsMock.On("Stat", "edited.go").Return(tests.MemFileInfo{Mtime: lockedMtime.Add(time.Hour)}, nil)
+	fsMock.On("Stat", "restored.go").Return(tests.MemFileInfo{Mtime: lockedMtime.Add(-time.Hour)}, nil)
+	fsMock.On("Stat", "new.go").Return(tests.MemFileInfo{Mtime: lockedMtime.Add(-time.Hour)}, nil)
+	fsMock.On("Stat", "vanished.go").Return(tests.MemFileInfo{}, os.ErrNotExist)
+
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.JSON = lockFileJson{Version: LockfileVersion, Projects: map[string]*singleProjectJson{
+		localProjectKey: {Tasks: map[string]taskLockJson{
+			"build": {Files: fileModTimes{
+				"kept.go":     lockedMtime.Unix(),
+				"edited.go":   lockedMtime.Unix(),
+				"restored.go": lockedMtime.Unix(),
+				"deleted.go":  lockedMtime.Unix(),
+				"vanished.go": lockedMtime.Unix(),
+			}},
+		}},
+	}}
+
+	task := Task{Name: "build", Files: []string{"edited.go", "kept.go", "new.go", "restored.go", "vanished.go"}}
+	staleness, err := lockfile.Staleness(task, nil)
+
+	require.Nil(t, err)
+	require.True(t, staleness.Stale())
+	locked := lockedMtime.Unix()
+	require.Equal(t, []FileChange{
+		{File: "deleted.go", Kind: FileRemoved, Old: locked},
+		{File: "edited.go", Kind: FileModified, Old: locked, New: locked + 3600},
+		{File: "new.go", Kind: FileAdded, New: locked - 3600},
+		{File: "restored.go", Kind: FileModified, Old: locked, New: locked - 3600},
+		{File: "vanished.go", Kind: FileRemoved, Old: locked},
+	}, staleness.Changes)
+	require.Equal(t, []string{"edited.go", "new.go", "restored.go"}, staleness.ChangedFiles())
+	require.Equal(t, "deleted.go was removed, edited.go was modified, new.go was added, restored.go was modified, vanished.go was removed", staleness.Reason())
+}
+
+func TestRecordTask(t *testing.T) {
+	var written []byte
+
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("Stat", "main.go").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil)
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(1).([]byte)
+	}).Return(nil)
+
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.Bootstrap()
+
+	task := Task{Name: "build", Files: []string{"main.go"}}
+	staleness, err := lockfile.Staleness(task, nil)
+	require.Nil(t, err)
+	require.True(t, staleness.NeverRan)
+	require.Nil(t, lockfile.RecordTask(task, staleness))
+
+	var contents lockFileJson
+	require.Nil(t, json.Unmarshal(written, &contents))
+	require.Equal(t, LockfileVersion, contents.Version)
+	require.Equal(t, fileModTimes{"main.go": lockedMtime.Unix()}, contents.Projects[localProjectKey].Tasks["build"].Files)
+
+	staleness, err = lockfile.Staleness(task, nil)
+	require.Nil(t, err)
+	require.False(t, staleness.Stale())
 }
 
-func TestGenerateLockfileWithTrue(t *testing.T) {
+func TestStalenessDetectsChangedFingerprints(t *testing.T) {
 	fsMock := tests.NewFileSystem(t)
-	fsMock.On("Getwd").Return("path/to/cwd", nil)
-	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{}, nil)
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil)
 	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-	lockfile := NewLockfile(files, &lockfileOpts, fsMock)
-	err := lockfile.generateLockfile(true)
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.Bootstrap()
 
-	assert.Nil(t, err)
+	task := Task{Name: "build", Inputs: Inputs{Env: []string{"GOOS"}, Commands: []string{"go version"}}}
+	inputs := map[string]string{"env:GOOS": fingerprint("linux"), "cmd:go version": fingerprint("go1.19")}
+
+	staleness, err := lockfile.Staleness(task, inputs)
+	require.Nil(t, err)
+	require.Nil(t, lockfile.RecordTask(task, staleness))
+
+	staleness, err = lockfile.Staleness(task, inputs)
+	require.Nil(t, err)
+	require.False(t, staleness.Stale())
+
+	staleness, err = lockfile.Staleness(task, map[string]string{"env:GOOS": fingerprint("darwin"), "cmd:go version": fingerprint("go1.19")})
+	require.Nil(t, err)
+	require.Equal(t, []InputChange{{Input: "env:GOOS", Old: fingerprint("linux"), New: fingerprint("darwin")}}, staleness.ChangedInputs)
+	require.Equal(t, "$GOOS changed", staleness.Reason())
+}
+
+func TestInvalidateTask(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("Stat", "main.go").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil)
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.Bootstrap()
+
+	build := Task{Name: "build", Files: []string{"main.go"}}
+	lint := Task{Name: "lint", Files: []string{"main.go"}}
+
+	for _, task := range []Task{build, lint} {
+		staleness, err := lockfile.Staleness(task, nil)
+		require.Nil(t, err)
+		require.Nil(t, lockfile.RecordTask(task, staleness))
+	}
+
+	invalidated, err := lockfile.InvalidateTask("build")
+	require.Nil(t, err)
+	require.True(t, invalidated)
+
+	invalidated, err = lockfile.InvalidateTask("build")
+	require.Nil(t, err)
+	require.False(t, invalidated)
+
+	staleness, err := lockfile.Staleness(build, nil)
+	require.Nil(t, err)
+	require.True(t, staleness.NeverRan)
+
+	staleness, err = lockfile.Staleness(lint, nil)
+	require.Nil(t, err)
+	require.False(t, staleness.Stale())
 }
 
-func TestGenerateLockfileWithFalse(t *testing.T) {
+func TestInvalidateTaskOfLegacyProject(t *testing.T) {
 	fsMock := tests.NewFileSystem(t)
-	fsMock.On("Getwd").Return("path/to/cwd", nil)
-	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{}, nil)
+	fsMock.On("UserCacheDir").Return("/home/me/.cache", nil)
+	fsMock.On("FileExists", mock.Anything).Return(true)
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(dotGokeFile), nil)
+	fsMock.On("Getwd").Return("/path/to/project1", nil)
+	fsMock.On("Stat", "path/to/file").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil)
 	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-	lockfile := NewLockfile(files, &lockfileOpts, fsMock)
-	err := lockfile.generateLockfile(true)
+	lockfile := NewLockfile(&Options{NoCache: true}, fsMock)
+	lockfile.Bootstrap()
+
+	invalidated, err := lockfile.InvalidateTask("build")
+	require.Nil(t, err)
+	require.True(t, invalidated)
+
+	staleness, err := lockfile.Staleness(Task{Name: "build", Files: []string{"path/to/file"}}, nil)
+	require.Nil(t, err)
+	require.True(t, staleness.Stale())
+
+	staleness, err = lockfile.Staleness(Task{Name: "lint", Files: []string{"path/to/file"}}, nil)
+	require.Nil(t, err)
+	require.False(t, staleness.Stale())
+}
+
+func TestBootstrapRecoversFromCorruptLockfile(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("FileExists", mock.Anything).Return(true)
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(`{"version": 2, "projects": {"/path/to`), nil)
+
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.Bootstrap()
+
+	require.Empty(t, lockfile.JSON.Projects)
+}
+
+func TestRecordTaskKeepsConcurrentChanges(t *testing.T) {
+	var written []byte
+	other := `{"version": 2, "projects": {"/path/to/other": {"tasks": {"test": {"files": {}}}}}}`
+
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("FileExists", mock.Anything).Return(true)
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(`{"version": 2, "projects": {}}`), nil).Once()
+	fsMock.On("ReadFile", mock.Anything).Return([]byte(other), nil).Once()
+	fsMock.On("Stat", "main.go").Return(tests.MemFileInfo{Mtime: lockedMtime}, nil)
+	fsMock.On("Lock", mock.Anything).Return(unlock, nil).Once()
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(1).([]byte)
+	}).Return(nil).Once()
+
+	lockfile := NewLockfile(&lockfileOpts, fsMock)
+	lockfile.Bootstrap()
+
+	// Another goke process recorded a task after this one bootstrapped.
+	task := Task{Name: "build", Files: []string{"main.go"}}
+	staleness, err := lockfile.Staleness(task, nil)
+	require.Nil(t, err)
+	require.Nil(t, lockfile.RecordTask(task, staleness))
 
-	assert.Nil(t, err)
+	var contents lockFileJson
+	require.Nil(t, json.Unmarshal(written, &contents))
+	require.Contains(t, contents.Projects, "/path/to/other")
+	require.Contains(t, contents.Projects[localProjectKey].Tasks, "build")
 }
@@ -0,0 +1,370 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/theckman/yacspin"
+)
+
+// The available output modes, selected via --output.
+const (
+	OutputAuto     = "auto"
+	OutputSpinner  = "spinner"
+	OutputPlain    = "plain"
+	OutputPrefixed = "prefixed"
+	OutputGrouped  = "grouped"
+	OutputCI       = "ci"
+)
+
+var OutputModes = []string{OutputAuto, OutputSpinner, OutputPlain, OutputPrefixed, OutputGrouped, OutputCI}
+
+var spinnerCfg = yacspin.Config{
+	Frequency:         100 * time.Millisecond,
+	Colors:            []string{"fgYellow"},
+	CharSet:           yacspin.CharSets[11],
+	Suffix:            " ",
+	SuffixAutoColon:   true,
+	Message:           "Running commands",
+	StopCharacter:     "✓",
+	StopColors:        []string{"fgGreen"},
+	StopMessage:       "Done",
+	StopFailCharacter: "✗",
+	StopFailColors:    []string{"fgRed"},
+	StopFailMessage:   "Failed",
+}
+
+// Renderer displays the progress of a run to the user.
+type Renderer interface {
+	Start()
+	TaskStarted(task string)
+	TaskFinished(task string, err error)
+	CommandStarted(task string, cmd string)
+	CommandOutput(task string, output string)
+	Pause()
+	Resume()
+	Message(message string)
+	Stop(message string, failed bool)
+}
+
+// NewRenderer creates the listener which renders the events for the given output mode.
+// An empty mode falls back to the interactive spinner.
+func NewRenderer(mode string, quiet bool, proc Process) (EventListener, error) {
+	if err := ValidateOutputMode(mode); err != nil {
+		return nil, err
+	}
+
+	if mode == OutputAuto {
+		mode = DetectOutputMode()
+	}
+
+	if quiet {
+		return &rendererListener{&quietRenderer{}}, nil
+	}
+
+	switch mode {
+	case "", OutputSpinner:
+		spinner, err := yacspin.New(spinnerCfg)
+		return &rendererListener{&spinnerRenderer{spinner: spinner, process: proc}}, err
+	case OutputPlain:
+		return &rendererListener{&plainRenderer{lineRenderer{process: proc}}}, nil
+	case OutputPrefixed:
+		return &rendererListener{&prefixedRenderer{lineRenderer{process: proc}}}, nil
+	case OutputGrouped:
+		return &rendererListener{&groupedRenderer{lineRenderer{process: proc}, make(map[string]*strings.Builder)}}, nil
+	default:
+		return &rendererListener{&ciRenderer{lineRenderer: lineRenderer{process: proc}}}, nil
+	}
+}
+
+// Passes the events of a run on to a renderer. Only what commands
+// wrote to stdout is rendered, stderr is part of the error instead.
+type rendererListener struct {
+	renderer Renderer
+}
+
+func (l *rendererListener) Handle(event Event) {
+	switch event.Type {
+	case EventRunStarted:
+		l.renderer.Start()
+	case EventTaskStarted:
+		l.renderer.TaskStarted(event.Task)
+	case EventTaskFinished:
+		var err error
+		if event.Error != "" {
+			err = errors.New(event.Error)
+		}
+
+		l.renderer.TaskFinished(event.Task, err)
+	case EventCommandStarted:
+		l.renderer.CommandStarted(event.Task, event.Command)
+		if event.Interactive {
+			l.renderer.Pause()
+		}
+	case EventCommandFinished:
+		if event.Interactive {
+			l.renderer.Resume()
+		}
+	case EventCommandOutput:
+		if event.Stream == StreamStdout {
+			l.renderer.CommandOutput(event.Task, event.Data)
+		}
+	case EventPrompt:
+		l.renderer.Pause()
+	case EventPromptAnswered:
+		l.renderer.Resume()
+	case EventMessage:
+		l.renderer.Message(event.Message)
+	case EventRunFinished:
+		l.renderer.Stop(event.Message, event.Error != "")
+	}
+}
+
+// ValidateOutputMode returns an error if the output mode is unknown.
+func ValidateOutputMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+
+	for _, m := range OutputModes {
+		if m == mode {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output mode '%s', must be one of: %s", mode, strings.Join(OutputModes, ", "))
+}
+
+// DetectOutputMode picks the output mode fitting the environment goke runs in:
+// folded groups on GitHub Actions, the spinner on a terminal and plain lines otherwise.
+func DetectOutputMode() string {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		return OutputCI
+	}
+
+	if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+		return OutputSpinner
+	}
+
+	return OutputPlain
+}
+
+// Discards everything, used for --quiet.
+type quietRenderer struct{}
+
+func (r *quietRenderer) Start()                        {}
+func (r *quietRenderer) TaskStarted(string)            {}
+func (r *quietRenderer) TaskFinished(string, error)    {}
+func (r *quietRenderer) CommandStarted(string, string) {}
+func (r *quietRenderer) CommandOutput(string, string)  {}
+func (r *quietRenderer) Pause()                        {}
+func (r *quietRenderer) Resume()                       {}
+func (r *quietRenderer) Message(string)                {}
+func (r *quietRenderer) Stop(string, bool)             {}
+
+// Shows the current command next to a spinner, meant for interactive terminals.
+type spinnerRenderer struct {
+	spinner *yacspin.Spinner
+	process Process
+}
+
+func (r *spinnerRenderer) Start() {
+	r.spinner.Start()
+}
+
+func (r *spinnerRenderer) TaskStarted(task string) {}
+
+func (r *spinnerRenderer) TaskFinished(task string, err error) {}
+
+func (r *spinnerRenderer) CommandStarted(task string, cmd string) {
+	r.spinner.Message(fmt.Sprintf("Running: %s", cmd))
+}
+
+func (r *spinnerRenderer) CommandOutput(task string, output string) {
+	r.process.Fprint(os.Stdout, "\n"+output+"\n")
+}
+
+// The spinner would draw over the output of interactive commands.
+func (r *spinnerRenderer) Pause() {
+	_ = r.spinner.Pause()
+	r.process.Fprint(os.Stdout, "\n")
+}
+
+func (r *spinnerRenderer) Resume() {
+	_ = r.spinner.Unpause()
+}
+
+func (r *spinnerRenderer) Message(message string) {
+	r.spinner.Message(message)
+}
+
+func (r *spinnerRenderer) Stop(message string, failed bool) {
+	if failed {
+		r.spinner.StopFailMessage(message)
+		r.spinner.StopFail()
+		return
+	}
+
+	r.spinner.StopMessage(message)
+	r.spinner.Stop()
+}
+
+// The behaviour shared by the renderers which write plain lines.
+type lineRenderer struct {
+	process     Process
+	lastMessage string
+}
+
+func (r *lineRenderer) Start() {}
+
+func (r *lineRenderer) Pause() {}
+
+func (r *lineRenderer) Resume() {}
+
+// Messages are repeated in watch mode, so only changes are written.
+func (r *lineRenderer) Message(message string) {
+	if message == r.lastMessage {
+		return
+	}
+
+	r.lastMessage = message
+	r.process.Fprint(os.Stdout, message+"\n")
+}
+
+func (r *lineRenderer) Stop(message string, failed bool) {
+	r.process.Fprint(os.Stdout, withTrailingNewline(message))
+}
+
+// Writes every command and its output line by line, meant for logs and pipes.
+type plainRenderer struct {
+	lineRenderer
+}
+
+func (r *plainRenderer) TaskStarted(task string) {}
+
+func (r *plainRenderer) TaskFinished(task string, err error) {}
+
+func (r *plainRenderer) CommandStarted(task string, cmd string) {
+	r.process.Fprint(os.Stdout, fmt.Sprintf("Running: %s\n", cmd))
+}
+
+func (r *plainRenderer) CommandOutput(task string, output string) {
+	r.process.Fprint(os.Stdout, withTrailingNewline(output))
+}
+
+// Prefixes every line with the name of the task it belongs to,
+// so that interleaved output can still be told apart.
+type prefixedRenderer struct {
+	lineRenderer
+}
+
+func (r *prefixedRenderer) TaskStarted(task string) {}
+
+func (r *prefixedRenderer) TaskFinished(task string, err error) {}
+
+func (r *prefixedRenderer) CommandStarted(task string, cmd string) {
+	r.process.Fprint(os.Stdout, prefixLines(task, "Running: "+cmd))
+}
+
+func (r *prefixedRenderer) CommandOutput(task string, output string) {
+	r.process.Fprint(os.Stdout, prefixLines(task, output))
+}
+
+// Buffers the output of every task and writes it in one block once the task finishes.
+type groupedRenderer struct {
+	lineRenderer
+	buffers map[string]*strings.Builder
+}
+
+func (r *groupedRenderer) TaskStarted(task string) {
+	if _, ok := r.buffers[task]; !ok {
+		r.buffers[task] = &strings.Builder{}
+	}
+}
+
+func (r *groupedRenderer) TaskFinished(task string, err error) {
+	buffer, ok := r.buffers[task]
+	if !ok {
+		return
+	}
+
+	delete(r.buffers, task)
+	status := "done"
+	if err != nil {
+		status = "failed"
+	}
+
+	r.process.Fprint(os.Stdout, fmt.Sprintf("==> %s (%s)\n%s", task, status, buffer.String()))
+}
+
+func (r *groupedRenderer) CommandStarted(task string, cmd string) {
+	r.TaskStarted(task)
+	r.buffers[task].WriteString(fmt.Sprintf("Running: %s\n", cmd))
+}
+
+func (r *groupedRenderer) CommandOutput(task string, output string) {
+	r.TaskStarted(task)
+	r.buffers[task].WriteString(withTrailingNewline(output))
+}
+
+// Folds the output of every top level task with GitHub Actions workflow commands.
+// Groups can't be nested, so nested tasks end up in the group of their parent.
+type ciRenderer struct {
+	lineRenderer
+	depth int
+}
+
+func (r *ciRenderer) TaskStarted(task string) {
+	if r.depth == 0 {
+		r.process.Fprint(os.Stdout, fmt.Sprintf("::group::%s\n", task))
+	}
+
+	r.depth++
+}
+
+func (r *ciRenderer) TaskFinished(task string, err error) {
+	r.depth--
+
+	if r.depth == 0 {
+		r.process.Fprint(os.Stdout, "::endgroup::\n")
+	}
+
+	if err != nil && r.depth == 0 {
+		r.process.Fprint(os.Stdout, fmt.Sprintf("::error title=goke::Task '%s' failed: %s\n", task, escapeWorkflowCommand(err.Error())))
+	}
+}
+
+func (r *ciRenderer) CommandStarted(task string, cmd string) {
+	r.process.Fprint(os.Stdout, fmt.Sprintf("Running: %s\n", cmd))
+}
+
+func (r *ciRenderer) CommandOutput(task string, output string) {
+	r.process.Fprint(os.Stdout, withTrailingNewline(output))
+}
+
+// Prefixes every line of the text with the task name.
+func prefixLines(task string, text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		b.WriteString(fmt.Sprintf("[%s] %s\n", task, line))
+	}
+
+	return b.String()
+}
+
+func withTrailingNewline(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+
+	return text + "\n"
+}
+
+// Escapes the characters which have a special meaning in workflow command values.
+func escapeWorkflowCommand(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
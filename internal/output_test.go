@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dugajean/goke/internal/tests"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a process mock which collects everything written through Fprint.
+func capturingProcess(t *testing.T) (*tests.Process, *strings.Builder) {
+	var out strings.Builder
+	process := tests.NewProcess(t)
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		out.WriteString(args.String(1))
+	}).Return(0, nil).Maybe()
+
+	return process, &out
+}
+
+// Renders a run of the "build" task, which invokes the nested "lint" task.
+func renderSampleRun(l EventListener) {
+	l.Handle(Event{Type: EventRunStarted, Tasks: []string{"build"}})
+	l.Handle(Event{Type: EventTaskStarted, Task: "build"})
+	l.Handle(Event{Type: EventTaskStarted, Task: "lint"})
+	l.Handle(Event{Type: EventCommandStarted, Task: "lint", Command: "go vet ./..."})
+	l.Handle(Event{Type: EventCommandOutput, Task: "lint", Stream: StreamStdout, Data: "all good"})
+	l.Handle(Event{Type: EventTaskFinished, Task: "lint"}.withResult(time.Second, nil))
+	l.Handle(Event{Type: EventCommandStarted, Task: "build", Command: "go build"})
+	l.Handle(Event{Type: EventCommandOutput, Task: "build", Stream: StreamStdout, Data: "line 1\nline 2\n"})
+	l.Handle(Event{Type: EventCommandOutput, Task: "build", Stream: StreamStderr, Data: "not rendered"})
+	l.Handle(Event{Type: EventTaskFinished, Task: "build"}.withResult(time.Second, errors.New("exit status 1")))
+	l.Handle(Event{Type: EventMessage, Message: "Watching for file changes..."})
+	l.Handle(Event{Type: EventMessage, Message: "Watching for file changes..."})
+	l.Handle(Event{Type: EventRunFinished, Message: "Error: exit status 1", Error: "Error: exit status 1"})
+}
+
+func TestPlainRenderer(t *testing.T) {
+	process, out := capturingProcess(t)
+	renderer, err := NewRenderer(OutputPlain, false, process)
+	require.Nil(t, err)
+
+	renderSampleRun(renderer)
+
+	want := `Running: go vet ./...
+all good
+Running: go build
+line 1
+line 2
+Watching for file changes...
+Error: exit status 1
+`
+	require.Equal(t, want, out.String())
+}
+
+func TestPrefixedRenderer(t *testing.T) {
+	process, out := capturingProcess(t)
+	renderer, err := NewRenderer(OutputPrefixed, false, process)
+	require.Nil(t, err)
+
+	renderSampleRun(renderer)
+
+	want := `[lint] Running: go vet ./...
+[lint] all good
+[build] Running: go build
+[build] line 1
+[build] line 2
+Watching for file changes...
+Error: exit status 1
+`
+	require.Equal(t, want, out.String())
+}
+
+func TestGroupedRenderer(t *testing.T) {
+	process, out := capturingProcess(t)
+	renderer, err := NewRenderer(OutputGrouped, false, process)
+	require.Nil(t, err)
+
+	renderSampleRun(renderer)
+
+	want := `==> lint (done)
+Running: go vet ./...
+all good
+==> build (failed)
+Running: go build
+line 1
+line 2
+Watching for file changes...
+Error: exit status 1
+`
+	require.Equal(t, want, out.String())
+}
+
+func TestCIRenderer(t *testing.T) {
+	process, out := capturingProcess(t)
+	renderer, err := NewRenderer(OutputCI, false, process)
+	require.Nil(t, err)
+
+	renderSampleRun(renderer)
+
+	want := `::group::build
+Running: go vet ./...
+all good
+Running: go build
+line 1
+line 2
+::endgroup::
+::error title=goke::Task 'build' failed: exit status 1
+Watching for file changes...
+Error: exit status 1
+`
+	require.Equal(t, want, out.String())
+}
+
+func TestQuietRenderer(t *testing.T) {
+	process, out := capturingProcess(t)
+	renderer, err := NewRenderer(OutputPlain, true, process)
+	require.Nil(t, err)
+
+	renderSampleRun(renderer)
+
+	require.Empty(t, out.String())
+}
+
+func TestNewRendererUnknownMode(t *testing.T) {
+	_, err := NewRenderer("fancy", false, nil)
+	require.NotNil(t, err)
+}
@@ -5,8 +5,11 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/dugajean/goke/internal/cli"
 	"gopkg.in/yaml.v3"
 )
@@ -15,47 +18,189 @@ type Parseable interface {
 	Bootstrap()
 	GetGlobal() *Global
 	GetTask(string) (Task, bool)
-	GetFilePaths() []string
+	GetTasks() []Task
+	ResolveTask(Task) (Task, error)
+	ExpandTask(Task) (Task, error)
 	parseTasks() error
 	parseGlobal() error
 	expandFilePaths(string) ([]string, error)
-	getTempFileName() string
+	getCacheFile() (string, error)
 	shouldClearCache(string) bool
 }
 
 type Task struct {
 	Name  string
+	Line  int               `yaml:"-"`
+	Desc  string            `yaml:"desc,omitempty"`
 	Files []string          `yaml:"files,omitempty"`
 	Run   []string          `yaml:"run"`
 	Env   map[string]string `yaml:"env,omitempty"`
+
+	// Attaches the commands of the task to the terminal instead of capturing their output.
+	Interactive bool `yaml:"interactive,omitempty"`
+
+	// A question which has to be confirmed before the task runs.
+	Prompt string `yaml:"prompt,omitempty"`
+
+	// Values besides the files which decide whether the task is up-to-date.
+	Inputs Inputs `yaml:"inputs,omitempty"`
+
+	// Skips the commands using {CHANGED_FILES} when no file changed.
+	SkipIfNoChanges bool `yaml:"skip_if_no_changes,omitempty"`
+
+	// Hooks of this task only, they run along with the global ones.
+	Events Events `yaml:"events,omitempty"`
+
+	// Excludes the task from all global hooks when false, or only from the listed ones.
+	Hooks     *bool    `yaml:"hooks,omitempty"`
+	SkipHooks []string `yaml:"skip_hooks,omitempty"`
+}
+
+// The hooks which run at certain points of a task,
+// and what happens when one of them fails.
+type Events struct {
+	BeforeEachRun  []string `yaml:"before_each_run,omitempty"`
+	AfterEachRun   []string `yaml:"after_each_run,omitempty"`
+	BeforeEachTask []string `yaml:"before_each_task,omitempty"`
+	AfterEachTask  []string `yaml:"after_each_task,omitempty"`
+	OnSuccess      []string `yaml:"on_success,omitempty"`
+	OnFailure      []string `yaml:"on_failure,omitempty"`
+	Finally        []string `yaml:"finally,omitempty"`
+	OnSkip         []string `yaml:"on_skip,omitempty"`
+	HookFailure    string   `yaml:"hook_failure,omitempty"`
+
+	// Which tasks the global hooks run for, only used in the global events.
+	Scope string `yaml:"scope,omitempty"`
+}
+
+// The environment variables and the outputs of probe commands, e.g. "go version",
+// which the task depends on. The task runs again when any of their values changes.
+type Inputs struct {
+	Env      []string `yaml:"env,omitempty"`
+	Commands []string `yaml:"commands,omitempty"`
+}
+
+// The names of the hooks, as used in goke.yml.
+const (
+	HookBeforeEachRun  = "before_each_run"
+	HookAfterEachRun   = "after_each_run"
+	HookBeforeEachTask = "before_each_task"
+	HookAfterEachTask  = "after_each_task"
+	HookOnSuccess      = "on_success"
+	HookOnFailure      = "on_failure"
+	HookFinally        = "finally"
+	HookOnSkip         = "on_skip"
+)
+
+var HookNames = []string{
+	HookBeforeEachRun, HookAfterEachRun, HookBeforeEachTask, HookAfterEachTask,
+	HookOnSuccess, HookOnFailure, HookFinally, HookOnSkip,
+}
+
+// The tasks global hooks run for: only the requested tasks, also the tasks
+// these invoke, or also the tasks these invoke including the hooks around
+// each of their commands.
+const (
+	HookScopeTopLevel     = "top_level"
+	HookScopeEveryTask    = "every_task"
+	HookScopeEveryCommand = "every_command"
+)
+
+var HookScopes = []string{HookScopeTopLevel, HookScopeEveryTask, HookScopeEveryCommand}
+
+// What happens when a hook fails: the task fails, a warning
+// is shown and the task goes on, or the failure is ignored.
+const (
+	HookFailureFail   = "fail"
+	HookFailureWarn   = "warn"
+	HookFailureIgnore = "ignore"
+)
+
+var HookFailurePolicies = []string{HookFailureFail, HookFailureWarn, HookFailureIgnore}
+
+// Whether the task is excluded from the given global hook.
+func (t Task) skipsHook(hook string) bool {
+	if t.Hooks != nil && !*t.Hooks {
+		return true
+	}
+
+	for _, skipped := range t.SkipHooks {
+		if skipped == hook {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the commands of the given hook.
+func (ev Events) commands(hook string) []string {
+	switch hook {
+	case HookBeforeEachRun:
+		return ev.BeforeEachRun
+	case HookAfterEachRun:
+		return ev.AfterEachRun
+	case HookBeforeEachTask:
+		return ev.BeforeEachTask
+	case HookAfterEachTask:
+		return ev.AfterEachTask
+	case HookOnSuccess:
+		return ev.OnSuccess
+	case HookOnFailure:
+		return ev.OnFailure
+	case HookFinally:
+		return ev.Finally
+	case HookOnSkip:
+		return ev.OnSkip
+	}
+
+	return nil
 }
 
 type Global struct {
 	Shared struct {
 		Env    map[string]string `yaml:"environment,omitempty"`
-		Events struct {
-			BeforeEachRun  []string `yaml:"before_each_run,omitempty"`
-			AfterEachRun   []string `yaml:"after_each_run,omitempty"`
-			BeforeEachTask []string `yaml:"before_each_task,omitempty"`
-			AfterEachTask  []string `yaml:"after_each_task,omitempty"`
-		} `yaml:"events,omitempty"`
+		Events Events            `yaml:"events,omitempty"`
+
+		// Leaves the files ignored by the project's .gitignore out of the tasks' files.
+		Gitignore bool `yaml:"gitignore,omitempty"`
+
+		// Where goke keeps the lockfile and the parser cache, relative to the project root.
+		StateDir string `yaml:"state_dir,omitempty"`
 	} `yaml:"global,omitempty"`
 }
 
 type parser struct {
 	Tasks     taskList
-	FilePaths []string
 	config    string
+	cacheFile string
 	options   Options
 	fs        FileSystem
 	Global
+
+	// The tasks whose environment was resolved, and whether the global one was.
+	resolved       taskList
+	globalResolved bool
 }
 
 type taskList map[string]Task
 
+// Replaced with the files of the task which changed since the last run when the command runs.
+const ChangedFilesPlaceholder = "{CHANGED_FILES}"
+
 var osCommandRegexp = regexp.MustCompile(`\$\((.+)\)`)
 var parserString string
 
+// The parser cache files start with it, followed by the fingerprints of the project and of the cache key.
+const parserCachePrefix = "goke-"
+
+// The parts of the parsed configuration which are cached. The environment of the tasks and the
+// variables in their commands are cached unresolved, since their values are often secrets, and so
+// are the patterns of their files, since the files they match change between runs.
+type parserCache struct {
+	Tasks taskList
+}
+
 // NewParser creates a parser instance which can be either a blank one,
 // or one provided  from the cache, which gets deserialized.
 func NewParser(cfg string, opts *Options, fs FileSystem) Parseable {
@@ -63,14 +208,28 @@ func NewParser(cfg string, opts *Options, fs FileSystem) Parseable {
 	p.fs = fs
 	p.config = cfg
 	p.options = *opts
+	p.resolved = make(taskList)
 
-	tempFile := path.Join(p.fs.TempDir(), p.getTempFileName())
+	removeLegacyParserCache()
+
+	err := p.parseGlobal()
+	if err != nil && !opts.Quiet {
+		log.Fatal(err)
+	}
+
+	tempFile, err := p.getCacheFile()
+	if err != nil && !opts.Quiet {
+		log.Fatal(err)
+	}
+
+	p.cacheFile = tempFile
 
 	if p.shouldClearCache(tempFile) {
 		_ = p.fs.Remove(tempFile)
 	}
 
 	if !p.fs.FileExists(tempFile) {
+		parserString = ""
 		return &p
 	}
 
@@ -82,35 +241,83 @@ func NewParser(cfg string, opts *Options, fs FileSystem) Parseable {
 	pStr := string(pBytes)
 	parserString = pStr
 
-	p = GOBDeserialize(pStr, &p)
+	// The mtime of a cache is when it was last used, see ParserCacheEntries. A cache
+	// which can't be touched still works, it's merely pruned sooner.
+	now := time.Now()
+	_ = p.fs.Chtimes(tempFile, now, now)
+
+	cached := GOBDeserialize(pStr, &parserCache{})
+	p.Tasks = cached.Tasks
+
 	return &p
 }
 
+// ClearParserCache removes the cached parsers of the current project, if any.
+func ClearParserCache(fs FileSystem) error {
+	files, err := projectParserCaches(fs)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := fs.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Bootstrap does the parsing process or skip if cached.
+// The environment is only resolved for the tasks which run, see ResolveTask.
 func (p *parser) Bootstrap() {
 	// Nothing too bootstrap if cached.
-	if parserString != "" {
-		return
+	if parserString == "" {
+		p.parseAndCache()
 	}
+}
 
-	err := p.parseGlobal()
+// Parses the tasks and caches them, only readable by the user, in place of the
+// project's previous caches.
+func (p *parser) parseAndCache() {
+	err := p.parseTasks()
 	if err != nil && !p.options.Quiet {
 		log.Fatal(err)
 	}
 
-	err = p.parseTasks()
+	pStr := GOBSerialize(parserCache{Tasks: p.Tasks})
+	err = p.fs.WriteFile(p.cacheFile, []byte(pStr), 0600)
+
 	if err != nil && !p.options.Quiet {
 		log.Fatal(err)
 	}
 
-	pStr := GOBSerialize(p)
-	err = p.fs.WriteFile(path.Join(p.fs.TempDir(), p.getTempFileName()), []byte(pStr), 0644)
-
+	err = p.removeStaleCaches()
 	if err != nil && !p.options.Quiet {
 		log.Fatal(err)
 	}
 }
 
+// Removes the project's caches of older configurations, or of other versions of goke.
+func (p *parser) removeStaleCaches() error {
+	files, err := projectParserCaches(p.fs)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f == p.cacheFile {
+			continue
+		}
+
+		if err := p.fs.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *parser) GetGlobal() *Global {
 	return &p.Global
 }
@@ -120,64 +327,133 @@ func (p *parser) GetTask(taskName string) (Task, bool) {
 	return task, ok
 }
 
-func (p *parser) GetFilePaths() []string {
-	return p.FilePaths
+// Returns all tasks sorted by their name.
+func (p *parser) GetTasks() []Task {
+	tasks := make([]Task, 0, len(p.Tasks))
+	for _, task := range p.Tasks {
+		tasks = append(tasks, task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name < tasks[j].Name
+	})
+
+	return tasks
 }
 
-// Parses the individual user defined tasks in the YAML config,
-// and processes the dynamic parts of both "run" and "files" sections.
-func (p *parser) parseTasks() error {
-	var tasks taskList
+// Returns the task with the patterns of its files expanded into the files they match
+// now, which also replace {FILES} in its commands. The patterns are kept unexpanded
+// by the parser, so that files added since the configuration was parsed are found.
+func (p *parser) ExpandTask(task Task) (Task, error) {
+	ignored, err := p.ignoredPatterns()
+	if err != nil {
+		return task, err
+	}
 
-	if err := yaml.Unmarshal([]byte(p.config), &tasks); err != nil {
-		return err
+	patterns := make([]string, len(task.Files))
+	for i := range task.Files {
+		patterns[i] = task.Files[i]
+		cli.ReplaceEnvironmentVariables(osCommandRegexp, &patterns[i])
 	}
 
-	allFilesPaths := []string{}
+	files, err := p.expandFiles(patterns, ignored)
+	if err != nil {
+		return task, err
+	}
 
-	for k, c := range tasks {
-		filePaths := []string{}
-		for i := range c.Files {
-			cli.ReplaceEnvironmentVariables(osCommandRegexp, &tasks[k].Files[i])
-			expanded, err := p.expandFilePaths(tasks[k].Files[i])
+	run := make([]string, len(task.Run))
+	for i, r := range task.Run {
+		run[i] = strings.Replace(r, "{FILES}", strings.Join(files, " "), -1)
+	}
 
-			if err != nil {
-				return err
-			}
+	task.Files = files
+	task.Run = run
 
-			filePaths = append(filePaths, expanded...)
-			allFilesPaths = append(allFilesPaths, expanded...)
-		}
+	return task, nil
+}
 
-		c.Files = filePaths
-		tasks[k] = c
+// Parses the individual user defined tasks in the YAML config.
+// The patterns of their "files" sections are expanded when they run, see ExpandTask.
+func (p *parser) parseTasks() error {
+	var tasks taskList
 
-		for i, r := range c.Run {
-			tasks[k].Run[i] = strings.Replace(r, "{FILES}", strings.Join(c.Files, " "), -1)
-			cli.ReplaceEnvironmentVariables(osCommandRegexp, &tasks[k].Run[i])
-		}
+	if err := yaml.Unmarshal([]byte(p.config), &tasks); err != nil {
+		return err
+	}
 
-		if len(c.Env) != 0 {
-			vars, err := cli.SetEnvVariables(c.Env)
-			if err != nil {
-				return err
-			}
-			c.Env = vars
-		}
+	lines, err := taskLines(p.config)
+	if err != nil {
+		return err
+	}
+
+	for k, c := range tasks {
 		c.Name = k
+		c.Line = lines[k]
 		tasks[k] = c
 	}
 
 	delete(tasks, "global")
 
-	p.FilePaths = allFilesPaths
 	p.Tasks = tasks
 
 	return nil
 }
 
+// Maps every top level key in the yaml config to the line it is declared on.
+func taskLines(config string) (map[string]int, error) {
+	var root yaml.Node
+	lines := make(map[string]int)
+
+	if err := yaml.Unmarshal([]byte(config), &root); err != nil {
+		return nil, err
+	}
+
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return lines, nil
+	}
+
+	mapping := root.Content[0]
+	for i := 0; i < len(mapping.Content); i += 2 {
+		lines[mapping.Content[i].Value] = mapping.Content[i].Line
+	}
+
+	return lines, nil
+}
+
+// Returns the task with its environment resolved, including the global one, and with the
+// environment variables in its commands replaced. Since the values may come from $(...)
+// commands, they're only resolved for the tasks which run, once per invocation.
+func (p *parser) ResolveTask(task Task) (Task, error) {
+	if resolved, ok := p.resolved[task.Name]; ok {
+		return resolved, nil
+	}
+
+	if err := p.resolveGlobal(); err != nil {
+		return task, err
+	}
+
+	run := make([]string, len(task.Run))
+	for i := range task.Run {
+		run[i] = task.Run[i]
+		cli.ReplaceEnvironmentVariables(osCommandRegexp, &run[i])
+	}
+
+	task.Run = run
+
+	if len(task.Env) != 0 {
+		vars, err := cli.SetEnvVariables(task.Env)
+		if err != nil {
+			return task, err
+		}
+		task.Env = vars
+	}
+
+	p.resolved[task.Name] = task
+	return task, nil
+}
+
 // Parses the "global" key in the yaml config and adds it to the parser.
-// Also sets all variables under global.environment as OS environment variables.
+// The variables under global.environment are resolved once a task runs, see resolveGlobal.
 func (p *parser) parseGlobal() error {
 	var g Global
 
@@ -185,22 +461,65 @@ func (p *parser) parseGlobal() error {
 		return err
 	}
 
-	vars, err := cli.SetEnvVariables(g.Shared.Env)
-	if err != nil {
+	p.Global = g
+
+	return nil
+}
+
+// Sets all variables under global.environment as OS environment variables, once.
+func (p *parser) resolveGlobal() error {
+	if p.globalResolved {
 		return nil
 	}
 
-	g.Shared.Env = vars
-	p.Global = g
+	vars, err := cli.SetEnvVariables(p.Global.Shared.Env)
+	if err != nil {
+		return err
+	}
+
+	p.Global.Shared.Env = vars
+	p.globalResolved = true
 
 	return nil
 }
 
-// Expand the path glob and returns all paths in an array
+// Expands the entries of a task's "files" key into a sorted list of files.
+// Entries starting with "!" exclude the files they match, as do the ignored patterns.
+func (p *parser) expandFiles(entries []string, ignored []string) ([]string, error) {
+	files := []string{}
+	exclusions := append([]string{}, ignored...)
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "!") {
+			exclusions = append(exclusions, strings.TrimPrefix(entry, "!"))
+			continue
+		}
+
+		expanded, err := p.expandFilePaths(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, expanded...)
+	}
+
+	included := []string{}
+	for _, file := range uniqueSorted(files) {
+		if !matchesAny(exclusions, file) {
+			included = append(included, file)
+		}
+	}
+
+	return included, nil
+}
+
+// Expand the path glob and returns all paths in an array.
+// Patterns support "**" to match any number of directories,
+// and a directory stands for all files under it.
 func (p *parser) expandFilePaths(file string) ([]string, error) {
 	filePaths := []string{}
 
-	if strings.Contains(file, "*") {
+	if strings.ContainsAny(file, "*?[{") {
 		files, err := p.fs.Glob(file)
 		if err != nil {
 			return nil, err
@@ -211,35 +530,134 @@ func (p *parser) expandFilePaths(file string) ([]string, error) {
 		}
 	} else if p.fs.FileExists(file) {
 		filePaths = append(filePaths, file)
+	} else if info, err := p.fs.Stat(file); err == nil && info.IsDir() {
+		return p.fs.Glob(path.Join(filepath.ToSlash(file), "**"))
 	}
 
 	return filePaths, nil
 }
 
-// Retrieves the temp file name
-func (p *parser) getTempFileName() string {
-	cwd, _ := p.fs.Getwd()
-	return "goke-" + strings.Replace(cwd, string(filepath.Separator), "-", -1)
+// Returns the patterns of the files which never belong to a task.
+func (p *parser) ignoredPatterns() ([]string, error) {
+	ignored, err := p.gitignorePatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	// The state directory changes on every run, so its files never belong to a task.
+	if dir, ok := projectStateDir(p.options, p.fs); ok && dir != "." {
+		ignored = append(ignored, dir)
+	}
+
+	return ignored, nil
 }
 
-// Determines whether the parser cache should be cleaned or not
-func (p *parser) shouldClearCache(tempFile string) bool {
-	tempFileExists := p.fs.FileExists(tempFile)
-	mustCleanCache := false
+// Reads the patterns of the project's .gitignore, if enabled, as doublestar patterns.
+// Only the .gitignore in the project root is read, and negated patterns are not supported.
+func (p *parser) gitignorePatterns() ([]string, error) {
+	if !p.Global.Shared.Gitignore || !p.fs.FileExists(".gitignore") {
+		return nil, nil
+	}
+
+	content, err := p.fs.ReadFile(".gitignore")
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		line = strings.TrimSuffix(line, "/")
+		if strings.Contains(line, "/") {
+			patterns = append(patterns, strings.TrimPrefix(line, "/"))
+		} else {
+			patterns = append(patterns, "**/"+line)
+		}
+	}
+
+	return patterns, nil
+}
+
+// Whether the file, or one of the directories it is in, matches one of the patterns.
+// Both are cleaned first, so that e.g. "./src/**" matches "src/a.go".
+func matchesAny(patterns []string, file string) bool {
+	file = filepath.ToSlash(path.Clean(filepath.ToSlash(file)))
+
+	for _, pattern := range patterns {
+		pattern = path.Clean(filepath.ToSlash(pattern))
+
+		for _, p := range []string{pattern, pattern + "/**"} {
+			if ok, _ := doublestar.Match(p, file); ok {
+				return true
+			}
+		}
+	}
 
-	if !p.options.NoCache && tempFileExists {
-		tempStat, _ := p.fs.Stat(tempFile)
-		tempModTime := tempStat.ModTime().Unix()
+	return false
+}
 
-		configStat, _ := p.fs.Stat(CurrentConfigFile())
-		configModTime := configStat.ModTime().Unix()
+// Returns the sorted values without duplicates.
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
 
-		mustCleanCache = tempModTime < configModTime
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
 	}
 
-	if p.options.NoCache && tempFileExists {
-		mustCleanCache = true
+	sort.Strings(unique)
+	return unique
+}
+
+// Returns the location of the parser cache of the project for the current cache key.
+func (p *parser) getCacheFile() (string, error) {
+	dir, err := parserCacheDir(p.fs)
+	if err != nil {
+		return "", err
 	}
 
-	return mustCleanCache
+	root, err := p.fs.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, projectParserCachePrefix(root)+shortFingerprint(p.cacheKey())), nil
+}
+
+// Returns the key of the parser cache. A cache is only used by the same
+// version of goke, for the same configuration.
+func (p *parser) cacheKey() string {
+	return fingerprint(CURRENT_VERSION + "\n" + p.config)
+}
+
+// Returns the start of the names of the parser caches of the project in the given directory.
+func projectParserCachePrefix(root string) string {
+	return parserCachePrefix + shortFingerprint(fingerprint(root)) + "-"
+}
+
+// Returns the parser cache files of the current project, for any cache key.
+func projectParserCaches(fs FileSystem) ([]string, error) {
+	dir, err := parserCacheDir(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := fs.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Glob(path.Join(dir, projectParserCachePrefix(root)+"*"))
+}
+
+// Determines whether the parser cache should be cleaned or not
+func (p *parser) shouldClearCache(tempFile string) bool {
+	return p.options.NoCache && p.fs.FileExists(tempFile)
 }
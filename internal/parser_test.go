@@ -18,7 +18,7 @@ var baseOptions = Options{}
 
 func mockCacheDoesNotExist(t *testing.T) *tests.FileSystem {
 	fsMock := tests.NewFileSystem(t)
-	fsMock.On("TempDir").Return("path/to/temp")
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
 	fsMock.On("Getwd").Return("path/to/cwd", nil)
 	fsMock.On("FileExists", mock.Anything).Return(false).Twice()
 
@@ -27,7 +27,7 @@ func mockCacheDoesNotExist(t *testing.T) *tests.FileSystem {
 
 func mockCacheDoesNotExistOnce(t *testing.T) *tests.FileSystem {
 	fsMock := tests.NewFileSystem(t)
-	fsMock.On("TempDir").Return("path/to/temp")
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
 	fsMock.On("Getwd").Return("path/to/cwd", nil)
 	fsMock.On("FileExists", mock.Anything).Return(false).Once()
 	fsMock.On("FileExists", mock.Anything).Return(true).Once()
@@ -37,9 +37,9 @@ func mockCacheDoesNotExistOnce(t *testing.T) *tests.FileSystem {
 
 func mockCacheExists(t *testing.T) *tests.FileSystem {
 	fsMock := tests.NewFileSystem(t)
-	fsMock.On("TempDir").Return("path/to/temp")
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
 	fsMock.On("Getwd").Return("path/to/cwd", nil)
-	fsMock.On("FileExists", mock.Anything).Return(true).Twice()
+	fsMock.On("FileExists", mock.Anything).Return(true).Once()
 
 	return fsMock
 }
@@ -53,6 +53,7 @@ func TestNewParserWithoutCache(t *testing.T) {
 func TestNewParserWithCache(t *testing.T) {
 	fsMock := mockCacheDoesNotExistOnce(t)
 	fsMock.On("ReadFile", mock.Anything).Return([]byte(tests.ReadFileBase64), nil)
+	fsMock.On("Chtimes", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	parser := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock)
 	require.NotNil(t, parser)
@@ -60,16 +61,18 @@ func TestNewParserWithCache(t *testing.T) {
 
 func TestNewParserWithCacheAndWithoutClearCacheFlag(t *testing.T) {
 	fsMock := mockCacheExists(t)
-	fsMock.On("Stat", mock.Anything).Return(tests.MemFileInfo{}, nil).Twice()
 	fsMock.On("ReadFile", mock.Anything).Return([]byte(tests.ReadFileBase64), nil).Once()
 
+	// The cache is touched, since its mtime is when it was last used.
+	fsMock.On("Chtimes", mock.Anything, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(nil).Once()
+
 	parser := NewParser(tests.YamlConfigStub, &baseOptions, fsMock)
 	require.NotNil(t, parser)
 }
 
 func TestNewParserWithShouldClearCacheTrue(t *testing.T) {
 	fsMock := tests.NewFileSystem(t)
-	fsMock.On("TempDir").Return("path/to/temp")
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
 	fsMock.On("Getwd").Return("path/to/cwd", nil)
 	fsMock.On("FileExists", mock.Anything).Return(true).Once()
 	fsMock.On("FileExists", mock.Anything).Return(false).Once()
@@ -81,7 +84,6 @@ func TestNewParserWithShouldClearCacheTrue(t *testing.T) {
 
 func TestTaskParsing(t *testing.T) {
 	fsMock := mockCacheDoesNotExist(t)
-	fsMock.On("Glob", mock.Anything).Return([]string{"foo", "bar"}, nil).Once()
 	parser := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock)
 
 	parser.parseTasks()
@@ -96,15 +98,15 @@ func TestTaskParsing(t *testing.T) {
 
 func TestGlobalsParsing(t *testing.T) {
 	fsMock := mockCacheDoesNotExist(t)
-	parser := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock)
+	p := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock).(*parser)
 
-	parser.parseGlobal()
+	require.Nil(t, p.resolveGlobal())
 
 	require.Equal(t, "foo", os.Getenv("FOO"))
 	require.True(t, strings.Contains(os.Getenv("BAR"), "bar"))
 	require.Equal(t, "baz", os.Getenv("BAZ"))
 
-	global := parser.GetGlobal()
+	global := p.GetGlobal()
 	require.Equal(t, "foo", global.Shared.Env["FOO"])
 	require.True(t, strings.Contains(global.Shared.Env["BAR"], "bar"))
 	require.Equal(t, "baz", global.Shared.Env["BAZ"])
@@ -115,8 +117,142 @@ func TestTaskGlobFilesExpansion(t *testing.T) {
 	fsMock.On("Glob", mock.Anything).Return(tests.ExpectedGlob, nil)
 	parser := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock)
 
-	parser.parseTasks()
+	require.Nil(t, parser.parseTasks())
 	greetCatsTask, _ := parser.GetTask("greet-cats")
+	require.Equal(t, []string{"cmd/cli/*"}, greetCatsTask.Files)
+
+	greetCatsTask, err := parser.ExpandTask(greetCatsTask)
+	require.Nil(t, err)
+	require.Equal(t, []string{"bar", "foo"}, greetCatsTask.Files) // sorted
+}
+
+func TestTaskFilesExclusionsAndDirectories(t *testing.T) {
+	config := `
+build:
+  files: ["**/*.go", "docs", "!**/*_test.go", "!vendor"]
+  run:
+    - "go build"
+`
+
+	fsMock := mockCacheDoesNotExist(t)
+	fsMock.On("Glob", "**/*.go").Return([]string{"main.go", "internal/parser.go", "internal/parser_test.go", "vendor/lib/lib.go"}, nil).Once()
+	fsMock.On("FileExists", "docs").Return(false).Once()
+	fsMock.On("Stat", "docs").Return(tests.MemFileInfo{Dir: true}, nil).Once()
+	fsMock.On("Glob", "docs/**").Return([]string{"docs/index.md", "main.go"}, nil).Once()
+
+	parser := NewParser(config, &clearCacheOpts, fsMock)
+	require.Nil(t, parser.parseTasks())
+
+	build, _ := parser.GetTask("build")
+	build, err := parser.ExpandTask(build)
+	require.Nil(t, err)
+	require.Equal(t, []string{"docs/index.md", "internal/parser.go", "main.go"}, build.Files)
+}
+
+func TestTaskFilesDotSlashExclusions(t *testing.T) {
+	config := `
+build:
+  files: ["./src/**", "!./src/gen/**", "!./src/vendor/"]
+  run:
+    - "go build"
+`
+
+	fsMock := mockCacheDoesNotExist(t)
+	fsMock.On("Glob", "./src/**").Return([]string{"src/a.go", "src/gen/b.go", "src/vendor/c.go"}, nil).Once()
+
+	parser := NewParser(config, &clearCacheOpts, fsMock)
+	require.Nil(t, parser.parseTasks())
+
+	build, _ := parser.GetTask("build")
+	build, err := parser.ExpandTask(build)
+	require.Nil(t, err)
+	require.Equal(t, []string{"src/a.go"}, build.Files)
+}
+
+func TestTaskFilesGitignore(t *testing.T) {
+	config := `
+global:
+  gitignore: true
+
+build:
+  files: ["**/*"]
+  run:
+    - "go build"
+`
+
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
+	fsMock.On("Getwd").Return("path/to/cwd", nil)
+	fsMock.On("FileExists", ".gitignore").Return(true)
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("ReadFile", ".gitignore").Return([]byte("# build output\n/dist\nnode_modules/\n*.log\n!keep.log\n"), nil)
+	fsMock.On("Glob", "**/*").Return([]string{
+		"main.go", "dist/goke", "web/dist/app.js", "web/node_modules/x/index.js", "debug.log", "logs/keep.log",
+	}, nil).Once()
+
+	parser := NewParser(config, &clearCacheOpts, fsMock)
+	require.Nil(t, parser.parseGlobal())
+	require.Nil(t, parser.parseTasks())
+
+	build, _ := parser.GetTask("build")
+	build, err := parser.ExpandTask(build)
+	require.Nil(t, err)
+	require.Equal(t, []string{"main.go", "web/dist/app.js"}, build.Files)
+}
+
+func TestParserCacheKey(t *testing.T) {
+	config := `
+build:
+  files: ["src/**/*.go"]
+  run:
+    - "go build"
+`
+
+	p := parser{config: config}
+	require.Equal(t, p.cacheKey(), (&parser{config: config}).cacheKey())
+	require.NotEqual(t, p.cacheKey(), (&parser{config: config + "\n"}).cacheKey())
+}
+
+func TestParserCacheLeavesOutEnvValues(t *testing.T) {
+	config := `
+deploy:
+  env:
+    TOKEN: "$(echo s3cret)"
+  run:
+    - "deploy"
+`
+
+	var written []byte
+
+	fsMock := mockCacheDoesNotExist(t)
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, os.FileMode(0600)).Run(func(args mock.Arguments) {
+		written = args.Get(1).([]byte)
+	}).Return(nil).Once()
+	fsMock.On("Glob", mock.Anything).Return([]string{}, nil).Once()
+
+	p := NewParser(config, &clearCacheOpts, fsMock)
+	p.Bootstrap()
+
+	deploy, _ := p.GetTask("deploy")
+	require.Equal(t, "$(echo s3cret)", deploy.Env["TOKEN"])
+
+	deploy, err := p.ResolveTask(deploy)
+	require.Nil(t, err)
+	require.Equal(t, "s3cret", deploy.Env["TOKEN"])
+
+	cached := GOBDeserialize(string(written), &parserCache{})
+	require.Equal(t, "$(echo s3cret)", cached.Tasks["deploy"].Env["TOKEN"])
+}
+
+func TestParserCacheReplacesStaleCaches(t *testing.T) {
+	fsMock := mockCacheDoesNotExist(t)
+	fsMock.On("WriteFile", mock.Anything, mock.Anything, os.FileMode(0600)).Return(nil).Once()
+
+	p := NewParser(tests.YamlConfigStub, &clearCacheOpts, fsMock).(*parser)
+	prefix := "path/to/cache/goke/parser/" + projectParserCachePrefix("path/to/cwd")
+
+	fsMock.On("Glob", prefix+"*").Return([]string{prefix + "stale", p.cacheFile}, nil).Once()
+	fsMock.On("Remove", prefix+"stale").Return(nil).Once()
 
-	require.Equal(t, tests.ExpectedGlob, greetCatsTask.Files)
+	p.Bootstrap()
 }
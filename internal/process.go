@@ -1,22 +1,75 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-isatty"
 )
 
+// Returned by Confirm when there is no terminal to ask on.
+var ErrNotInteractive = errors.New("stdin is not a terminal")
+
 type Process interface {
-	Execute(name string, args ...string) ([]byte, error)
+	Execute(name string, args ...string) (stdout []byte, stderr []byte, err error)
+	ExecuteInteractive(name string, args ...string) error
+	Confirm(question string) (bool, error)
 	Fprint(w io.Writer, a ...any) (n int, err error)
 	Exit(code int)
 }
 
 type ShellProcess struct{}
 
-func (sp *ShellProcess) Execute(name string, args ...string) ([]byte, error) {
-	return exec.Command(name, args...).Output()
+// Runs the command and returns what it wrote to stdout and to stderr, whatever its exit code.
+// The stderr of a failed command is also kept in its *exec.ExitError, as with Output.
+func (sp *ShellProcess) Execute(name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Runs the command attached to the stdin, stdout and stderr of goke itself.
+func (sp *ShellProcess) ExecuteInteractive(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// Asks the question on the terminal, only "y" and "yes" count as confirmation.
+// The question goes to stderr, so that it doesn't end up in piped output.
+func (sp *ShellProcess) Confirm(question string) (bool, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return false, ErrNotInteractive
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
 }
 
 func (sp *ShellProcess) Fprint(w io.Writer, a ...any) (n int, err error) {
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type TaskStatus string
+
+const (
+	TaskRan     TaskStatus = "ran"
+	TaskSkipped TaskStatus = "skipped (up-to-date)"
+	TaskFailed  TaskStatus = "failed"
+	TaskCached  TaskStatus = "cached"
+)
+
+type taskResult struct {
+	Task     string
+	Status   TaskStatus
+	Duration time.Duration
+	ExitCode int
+}
+
+type commandTiming struct {
+	Task     string
+	Command  string
+	Duration time.Duration
+}
+
+// RunReport collects the outcome of every task and
+// command executed during a single invocation.
+type RunReport struct {
+	Tasks    []taskResult
+	Commands []commandTiming
+}
+
+// Handle records the outcome of tasks and commands as they finish.
+func (r *RunReport) Handle(event Event) {
+	switch event.Type {
+	case EventTaskFinished:
+		status := TaskRan
+		if event.Error != "" {
+			status = TaskFailed
+		}
+
+		r.Tasks = append(r.Tasks, taskResult{
+			Task:     event.Task,
+			Status:   status,
+			Duration: event.duration(),
+			ExitCode: eventExitCode(event),
+		})
+	case EventTaskSkipped:
+		status := TaskSkipped
+		if event.Reason == SkipAlreadyRan {
+			status = TaskCached
+		}
+
+		r.addTask(event.Task, status, 0, nil)
+	case EventCommandFinished:
+		r.addCommand(event.Task, event.Command, event.duration())
+	}
+}
+
+// Records the outcome of a task. The exit code is derived from the error the task failed with.
+func (r *RunReport) addTask(task string, status TaskStatus, duration time.Duration, err error) {
+	r.Tasks = append(r.Tasks, taskResult{
+		Task:     task,
+		Status:   status,
+		Duration: duration,
+		ExitCode: exitCode(err),
+	})
+}
+
+// Records how long a single command of the task took.
+func (r *RunReport) addCommand(task string, command string, duration time.Duration) {
+	r.Commands = append(r.Commands, commandTiming{
+		Task:     task,
+		Command:  command,
+		Duration: duration,
+	})
+}
+
+// Summary returns a table with the status, duration and exit code of every task.
+func (r *RunReport) Summary() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "TASK\tSTATUS\tDURATION\tEXIT CODE")
+	for _, t := range r.Tasks {
+		if t.Status == TaskRan || t.Status == TaskFailed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", t.Task, t.Status, formatDuration(t.Duration), t.ExitCode)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\n", t.Task, t.Status)
+		}
+	}
+
+	w.Flush()
+	return b.String()
+}
+
+// Timings returns a table with the duration of every command,
+// slowest first, along with its share of the total command time.
+func (r *RunReport) Timings() string {
+	var total time.Duration
+	commands := make([]commandTiming, len(r.Commands))
+	copy(commands, r.Commands)
+
+	for _, c := range commands {
+		total += c.Duration
+	}
+
+	sort.SliceStable(commands, func(i, j int) bool {
+		return commands[i].Duration > commands[j].Duration
+	})
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "TASK\tCOMMAND\tDURATION\tSHARE")
+	for _, c := range commands {
+		share := 100.0
+		if total > 0 {
+			share = float64(c.Duration) / float64(total) * 100
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.0f%%\n", c.Task, c.Command, formatDuration(c.Duration), share)
+	}
+
+	w.Flush()
+	return b.String()
+}
+
+// Returns the exit code of the process which caused the error,
+// 1 for any other error and 0 if there is no error.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return 1
+}
+
+// Returns the exit code carried by the event, 0 if there is none.
+func eventExitCode(event Event) int {
+	if event.ExitCode == nil {
+		return 0
+	}
+
+	return *event.ExitCode
+}
+
+// Rounds the duration to milliseconds, or microseconds for very quick commands.
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+
+	return d.Round(time.Millisecond).String()
+}
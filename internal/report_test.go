@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReportSummary(t *testing.T) {
+	report := RunReport{}
+	report.addTask("lint", TaskRan, 1500*time.Millisecond, nil)
+	report.addTask("test", TaskFailed, 20*time.Millisecond, errors.New("boom"))
+	report.addTask("build", TaskSkipped, 0, nil)
+	report.addTask("lint", TaskCached, 0, nil)
+
+	want := `TASK   STATUS                DURATION  EXIT CODE
+lint   ran                   1.5s      0
+test   failed                20ms      1
+build  skipped (up-to-date)  -         -
+lint   cached                -         -
+`
+
+	require.Equal(t, want, report.Summary())
+}
+
+func TestRunReportTimings(t *testing.T) {
+	report := RunReport{}
+	report.addCommand("main", "go vet ./...", 250*time.Millisecond)
+	report.addCommand("main", "go build ./...", 750*time.Millisecond)
+
+	want := `TASK  COMMAND         DURATION  SHARE
+main  go build ./...  750ms     75%
+main  go vet ./...    250ms     25%
+`
+
+	require.Equal(t, want, report.Timings())
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, 0, exitCode(nil))
+	require.Equal(t, 1, exitCode(errors.New("boom")))
+}
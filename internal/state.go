@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides the directory goke keeps its state in, i.e. the lockfile and the parser caches.
+const EnvStateDir = "GOKE_STATE_DIR"
+
+// The files and directories in the state directory.
+const (
+	lockfileName       = "lockfile.json"
+	parserCacheDirName = "parser"
+)
+
+// The key of the project in a configured state directory.
+const localProjectKey = "."
+
+// Returns the state directory configured for the project, by $GOKE_STATE_DIR or else by
+// global.state_dir in the configuration. Relative directories are resolved against the
+// project root. Returns an empty string when none is configured.
+func ConfiguredStateDir(cfg string, fs FileSystem) (string, error) {
+	dir := os.Getenv(EnvStateDir)
+
+	if dir == "" {
+		// Mistakes in the configuration are reported once it's parsed.
+		var g Global
+		_ = yaml.Unmarshal([]byte(cfg), &g)
+		dir = g.Shared.StateDir
+	}
+
+	if dir == "" {
+		return "", nil
+	}
+
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir), nil
+	}
+
+	root, err := fs.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, dir), nil
+}
+
+// Returns the directory goke keeps its state in: the configured one, or else the default one.
+func stateDir(opts Options, fs FileSystem) (string, error) {
+	if opts.StateDir != "" {
+		return opts.StateDir, nil
+	}
+
+	return defaultStateDir(fs)
+}
+
+// Returns the goke directory in the user's cache dir, e.g. ~/.cache/goke.
+func defaultStateDir(fs FileSystem) (string, error) {
+	cacheDir, err := fs.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(cacheDir, "goke"), nil
+}
+
+// Returns the path of the state directory relative to the project root,
+// and whether the state directory is inside the project at all.
+func projectStateDir(opts Options, fs FileSystem) (string, bool) {
+	if opts.StateDir == "" {
+		return "", false
+	}
+
+	root, err := fs.Getwd()
+	if err != nil {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(root, opts.StateDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
+
+// Returns the key under which the state of the current project is kept. It's the project
+// root in the default state directory, which all projects share. A configured state directory
+// belongs to a single project, so there it's the project root relative to itself, and the
+// state stays valid when the project moves, e.g. when it's restored from a CI cache.
+func projectKey(opts Options, fs FileSystem) (string, error) {
+	if opts.StateDir != "" {
+		return localProjectKey, nil
+	}
+
+	return fs.Getwd()
+}
+
+// Returns the directory of the parser caches. It's always in the user's cache dir, even
+// when the state directory is in the project, so that the caches are never shared.
+func parserCacheDir(fs FileSystem) (string, error) {
+	dir, err := defaultStateDir(fs)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, parserCacheDirName), nil
+}
+
+// Returns the location of the lockfile used before the state directory existed.
+// It's still read when there's no lockfile in the default state directory yet.
+func legacyLockfilePath() (string, error) {
+	user, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(user.HomeDir, ".goke"), nil
+}
+
+// Removes the parser cache of the project in the working directory which older versions
+// of goke kept in the temp dir, readable by anyone and with the values of the environment.
+func removeLegacyParserCache() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	name := parserCachePrefix + strings.Replace(cwd, string(filepath.Separator), "-", -1)
+	_ = os.Remove(filepath.Join(os.TempDir(), name))
+}
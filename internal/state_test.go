@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/dugajean/goke/internal/tests"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const stateDirConfig = `global:
+  state_dir: .goke/
+
+build:
+  files: ["**/*"]
+  run:
+    - "go build ./..."
+`
+
+func TestConfiguredStateDir(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("Getwd").Return("/code/app", nil)
+
+	dir, err := ConfiguredStateDir(stateDirConfig, fsMock)
+	require.Nil(t, err)
+	require.Equal(t, "/code/app/.goke", dir)
+
+	dir, err = ConfiguredStateDir(tests.YamlConfigStub, fsMock)
+	require.Nil(t, err)
+	require.Equal(t, "", dir)
+}
+
+func TestConfiguredStateDirFromEnv(t *testing.T) {
+	t.Setenv(EnvStateDir, "/ci/cache/goke")
+
+	dir, err := ConfiguredStateDir(stateDirConfig, tests.NewFileSystem(t))
+	require.Nil(t, err)
+	require.Equal(t, "/ci/cache/goke", dir)
+}
+
+func TestStateDirDefaultsToUserCacheDir(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("UserCacheDir").Return("/home/me/.cache", nil)
+
+	dir, err := stateDir(Options{}, fsMock)
+	require.Nil(t, err)
+	require.Equal(t, "/home/me/.cache/goke", dir)
+}
+
+func TestProjectKey(t *testing.T) {
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("Getwd").Return("/code/app", nil)
+
+	key, err := projectKey(Options{StateDir: "/code/app/.goke"}, fsMock)
+	require.Nil(t, err)
+	require.Equal(t, localProjectKey, key)
+
+	key, err = projectKey(Options{StateDir: "/ci/cache/goke"}, fsMock)
+	require.Nil(t, err)
+	require.Equal(t, localProjectKey, key)
+
+	key, err = projectKey(Options{}, fsMock)
+	require.Nil(t, err)
+	require.Equal(t, "/code/app", key)
+}
+
+func TestTaskFilesLeaveOutStateDir(t *testing.T) {
+	opts := Options{NoCache: true, StateDir: "/code/app/.goke"}
+
+	fsMock := tests.NewFileSystem(t)
+	fsMock.On("UserCacheDir").Return("/home/me/.cache", nil)
+	fsMock.On("Getwd").Return("/code/app", nil)
+	fsMock.On("FileExists", mock.Anything).Return(false)
+	fsMock.On("Glob", "**/*").Return([]string{".goke/lockfile.json", ".goke/lockfile.json.lock", "main.go"}, nil)
+
+	p := NewParser(stateDirConfig, &opts, fsMock)
+	require.Nil(t, p.parseTasks())
+
+	task, _ := p.GetTask("build")
+	task, err := p.ExpandTask(task)
+	require.Nil(t, err)
+	require.Equal(t, []string{"main.go"}, task.Files)
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// The states of a task as shown by "goke status".
+const (
+	TaskStateUpToDate   = "up-to-date"
+	TaskStateStale      = "stale"
+	TaskStateAlwaysRuns = "always runs"
+)
+
+// Why a task would run, or not, if it was requested now.
+type TaskExplanation struct {
+	Task    string
+	State   string
+	Reasons []string
+}
+
+// Explains whether the task would run, using the same checks as a run does.
+// Probe commands of the task's inputs are run, but the lockfile isn't touched.
+func (e *Executor) Explain(task Task) (TaskExplanation, error) {
+	explanation := TaskExplanation{Task: task.Name}
+
+	if !task.hasInputs() {
+		explanation.State = TaskStateAlwaysRuns
+		explanation.Reasons = []string{"it has no files or inputs"}
+		return explanation, nil
+	}
+
+	staleness, err := e.taskStaleness(task)
+	if err != nil {
+		return explanation, err
+	}
+
+	if e.options.Force {
+		explanation.Reasons = append(explanation.Reasons, "--force was given")
+	}
+
+	if staleness.Stale() {
+		explanation.Reasons = append(explanation.Reasons, staleness.Details()...)
+	}
+
+	if len(explanation.Reasons) == 0 {
+		explanation.State = TaskStateUpToDate
+		explanation.Reasons = []string{"none of its inputs changed since its last successful run"}
+		return explanation, nil
+	}
+
+	explanation.State = TaskStateStale
+	return explanation, nil
+}
+
+// Writes the state of every task, along with the short reason for stale tasks.
+func (e *Executor) WriteStatus(out io.Writer, tasks []Task) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	for _, task := range tasks {
+		explanation, err := e.Explain(task)
+		if err != nil {
+			return err
+		}
+
+		reason := ""
+		if explanation.State == TaskStateStale {
+			staleness, _ := e.taskStaleness(task)
+			reason = staleness.Reason()
+			if e.options.Force {
+				reason = "forced"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", task.Name, explanation.State, reason)
+	}
+
+	return w.Flush()
+}
+
+// Writes every reason why the task would run, or why it wouldn't.
+func (e *Executor) WriteWhy(out io.Writer, task Task) error {
+	explanation, err := e.Explain(task)
+	if err != nil {
+		return err
+	}
+
+	switch explanation.State {
+	case TaskStateUpToDate:
+		fmt.Fprintf(out, "Task '%s' is up-to-date:\n", task.Name)
+	default:
+		fmt.Fprintf(out, "Task '%s' will run:\n", task.Name)
+	}
+
+	for _, reason := range explanation.Reasons {
+		fmt.Fprintf(out, "  %s\n", reason)
+	}
+
+	return nil
+}
+
+// Checks whether the tasks are up-to-date without running any of their commands.
+// Finishes with ExitStale and the reasons if any of them is stale.
+func (e *Executor) check(taskNames []string) error {
+	tasks := e.initTasks(taskNames)
+	stale := []string{}
+
+	for _, task := range tasks {
+		explanation, err := e.Explain(task)
+		if err != nil {
+			return err
+		}
+
+		if explanation.State == TaskStateStale {
+			stale = append(stale, fmt.Sprintf("%s: %s", task.Name, strings.Join(explanation.Reasons, ", ")))
+		}
+	}
+
+	if len(stale) > 0 {
+		e.logExit(ExitStale, fmt.Sprintf("%d task(s) are stale\n%s", len(stale), strings.Join(stale, "\n")))
+		return nil
+	}
+
+	e.logExit(0, "All tasks are up-to-date")
+	return nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const statusConfig = `
+build:
+  files: [cmd/cli/*]
+  run:
+    - "echo 'build'"
+
+greet:
+  run:
+    - "echo 'hello'"
+`
+
+func TestWriteStatus(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, statusConfig)
+	process.On("Execute", "echo", "build").Return([]byte("build"), nil, nil).Once()
+	process.On("Fprint", mock.Anything, mock.AnythingOfType("string")).Return(10, nil)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+
+	var out bytes.Buffer
+	require.Nil(t, executor.WriteStatus(&out, (*parser).GetTasks()))
+	require.Equal(t, "build  stale        no previous successful run\ngreet  always runs  \n", out.String())
+
+	executor.Start([]string{"build"})
+
+	out.Reset()
+	executor = NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	require.Nil(t, executor.WriteStatus(&out, (*parser).GetTasks()))
+	require.Equal(t, "build  up-to-date   \ngreet  always runs  \n", out.String())
+}
+
+func TestWriteWhy(t *testing.T) {
+	forceOpts := Options{NoCache: true, Force: true}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &forceOpts, statusConfig)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &forceOpts, process, fsMock, &ctx)
+	task, _ := (*parser).GetTask("build")
+
+	var out bytes.Buffer
+	require.Nil(t, executor.WriteWhy(&out, task))
+	require.Equal(t, "Task 'build' will run:\n  --force was given\n  no previous successful run is recorded\n", out.String())
+}
+
+func TestTouch(t *testing.T) {
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &clearCacheOpts, statusConfig)
+
+	ctx := context.Background()
+	executor := NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+
+	build, _ := (*parser).GetTask("build")
+	require.Nil(t, executor.Touch(build))
+
+	greet, _ := (*parser).GetTask("greet")
+	require.EqualError(t, executor.Touch(greet), "task 'greet' has no files or inputs, it always runs")
+
+	var out bytes.Buffer
+	executor = NewExecutor(parser, lockfile, &clearCacheOpts, process, fsMock, &ctx)
+	require.Nil(t, executor.WriteStatus(&out, (*parser).GetTasks()))
+	require.Equal(t, "build  up-to-date   \ngreet  always runs  \n", out.String())
+}
+
+func TestCheck(t *testing.T) {
+	checkOpts := Options{NoCache: true, Check: true}
+	parser, lockfile, process, fsMock := getDependenciesForConfig(t, &checkOpts, statusConfig)
+	process.On("Exit", ExitStale).Return().Once()
+	process.On("Exit", 0).Return().Once()
+
+	ctx := context.Background()
+	listener := &recordingListener{}
+	executor := NewExecutor(parser, lockfile, &checkOpts, process, fsMock, &ctx)
+	executor.AddListener(listener)
+	executor.Start([]string{"build", "greet"})
+
+	last := listener.events[len(listener.events)-1]
+	require.Equal(t, EventRunFinished, last.Type)
+	require.Equal(t, "1 task(s) are stale\nbuild: no previous successful run is recorded", last.Error)
+
+	build, _ := (*parser).GetTask("build")
+	require.Nil(t, executor.Touch(build))
+
+	executor = NewExecutor(parser, lockfile, &checkOpts, process, fsMock, &ctx)
+	executor.Start([]string{"build", "greet"})
+
+	process.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything)
+}
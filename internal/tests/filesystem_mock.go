@@ -5,6 +5,8 @@ package tests
 import (
 	fs "io/fs"
 
+	time "time"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,6 +15,20 @@ type FileSystem struct {
 	mock.Mock
 }
 
+// Chtimes provides a mock function with given fields: name, atime, mtime
+func (_m *FileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	ret := _m.Called(name, atime, mtime)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, time.Time, time.Time) error); ok {
+		r0 = rf(name, atime, mtime)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // FileExists provides a mock function with given fields: filename
 func (_m *FileSystem) FileExists(filename string) bool {
 	ret := _m.Called(filename)
@@ -71,6 +87,29 @@ func (_m *FileSystem) Glob(path string) ([]string, error) {
 	return r0, r1
 }
 
+// Lock provides a mock function with given fields: name
+func (_m *FileSystem) Lock(name string) (func() error, error) {
+	ret := _m.Called(name)
+
+	var r0 func() error
+	if rf, ok := ret.Get(0).(func(string) func() error); ok {
+		r0 = rf(name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(func() error)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ReadFile provides a mock function with given fields: name
 func (_m *FileSystem) ReadFile(name string) ([]byte, error) {
 	ret := _m.Called(name)
@@ -131,8 +170,8 @@ func (_m *FileSystem) Stat(name string) (fs.FileInfo, error) {
 	return r0, r1
 }
 
-// TempDir provides a mock function with given fields:
-func (_m *FileSystem) TempDir() string {
+// UserCacheDir provides a mock function with given fields:
+func (_m *FileSystem) UserCacheDir() (string, error) {
 	ret := _m.Called()
 
 	var r0 string
@@ -142,7 +181,14 @@ func (_m *FileSystem) TempDir() string {
 		r0 = ret.Get(0).(string)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // WriteFile provides a mock function with given fields: name, data, perm
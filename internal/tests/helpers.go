@@ -13,7 +13,7 @@ const ReadFileBase64 = "Sf+BAwEBBlBhcnNlcgH/ggABBAEFVGFza3MB/4gAAQlGaWxlUGF0aHMB
 func GetFileSystemMock(t *testing.T) any {
 	fsMock := NewFileSystem(t)
 
-	fsMock.On("TempDir").Return("path/to/temp")
+	fsMock.On("UserCacheDir").Return("path/to/cache", nil)
 	fsMock.On("Getwd").Return("path/to/cwd", nil)
 	fsMock.On("FileExists", mock.Anything).Return(true)
 	fsMock.On("Remove", mock.Anything).Return(nil)
@@ -26,6 +26,7 @@ func GetFileSystemMock(t *testing.T) any {
 
 type MemFileInfo struct {
 	Mtime time.Time
+	Dir   bool
 }
 
 func (fi MemFileInfo) Name() string {
@@ -49,7 +50,7 @@ func (fi MemFileInfo) ModTime() time.Time {
 }
 
 func (fi MemFileInfo) IsDir() bool {
-	return false
+	return fi.Dir
 }
 
 func (fi MemFileInfo) Sys() any {
@@ -76,6 +77,7 @@ events:
     - "echo 'after task'"
 
 greet-lisha:
+  desc: "Greets Lisha"
   run:
     - "echo 'Hello Lisha!'"
 
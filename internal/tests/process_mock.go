@@ -13,8 +13,29 @@ type Process struct {
 	mock.Mock
 }
 
+// Confirm provides a mock function with given fields: question
+func (_m *Process) Confirm(question string) (bool, error) {
+	ret := _m.Called(question)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(question)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(question)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Execute provides a mock function with given fields: name, args
-func (_m *Process) Execute(name string, args ...string) ([]byte, error) {
+func (_m *Process) Execute(name string, args ...string) ([]byte, []byte, error) {
 	_va := make([]interface{}, len(args))
 	for _i := range args {
 		_va[_i] = args[_i]
@@ -33,14 +54,44 @@ func (_m *Process) Execute(name string, args ...string) ([]byte, error) {
 		}
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(string, ...string) error); ok {
+	var r1 []byte
+	if rf, ok := ret.Get(1).(func(string, ...string) []byte); ok {
 		r1 = rf(name, args...)
 	} else {
-		r1 = ret.Error(1)
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
 	}
 
-	return r0, r1
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, ...string) error); ok {
+		r2 = rf(name, args...)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ExecuteInteractive provides a mock function with given fields: name, args
+func (_m *Process) ExecuteInteractive(name string, args ...string) error {
+	_va := make([]interface{}, len(args))
+	for _i := range args {
+		_va[_i] = args[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, name)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, ...string) error); ok {
+		r0 = rf(name, args...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // Exit provides a mock function with given fields: code
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidateConfig checks the configuration for mistakes which the parser
+// silently tolerates, such as unknown keys and tasks without commands.
+func ValidateConfig(cfg string) []error {
+	var root yaml.Node
+
+	if err := yaml.Unmarshal([]byte(cfg), &root); err != nil {
+		return []error{err}
+	}
+
+	if len(root.Content) == 0 {
+		return []error{fmt.Errorf("the configuration is empty")}
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return []error{fmt.Errorf("line %d: the configuration must be a map of tasks", doc.Line)}
+	}
+
+	var problems []error
+	globalType := reflect.TypeOf(Global{}.Shared)
+	taskType := reflect.TypeOf(Task{})
+	subcommands := subcommandNames()
+
+	for i := 0; i < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+
+		if key.Value == "global" {
+			problems = append(problems, unknownKeys(value, globalType, "global")...)
+
+			var global Global
+			if err := value.Decode(&global.Shared); err == nil {
+				events := global.Shared.Events
+				problems = append(problems, checkAllowed(key.Line, "global", "hook failure policy", events.HookFailure, HookFailurePolicies)...)
+				problems = append(problems, checkAllowed(key.Line, "global", "hook scope", events.Scope, HookScopes)...)
+			}
+
+			continue
+		}
+
+		problems = append(problems, unknownKeys(value, taskType, key.Value)...)
+
+		for _, name := range subcommands {
+			if name == key.Value {
+				problems = append(problems, fmt.Errorf("line %d: task \"%s\" is shadowed by the \"goke %s\" command, rename it or run it with \"goke run %s\"", key.Line, key.Value, name, name))
+			}
+		}
+
+		var task Task
+		if err := value.Decode(&task); err != nil {
+			problems = append(problems, fmt.Errorf("line %d: task \"%s\": %s", key.Line, key.Value, err))
+		} else if len(task.Run) == 0 {
+			problems = append(problems, fmt.Errorf("line %d: task \"%s\" has no commands to run", key.Line, key.Value))
+		} else {
+			problems = append(problems, checkAllowed(key.Line, key.Value, "hook failure policy", task.Events.HookFailure, HookFailurePolicies)...)
+
+			for _, hook := range task.SkipHooks {
+				problems = append(problems, checkAllowed(key.Line, key.Value, "hook", hook, HookNames)...)
+			}
+
+			if task.Events.Scope != "" {
+				problems = append(problems, fmt.Errorf("line %d: the hook scope can only be set in \"global.events\", not in \"%s\"", key.Line, key.Value))
+			}
+		}
+	}
+
+	return problems
+}
+
+// Reports a value which isn't one of the allowed ones, empty values are fine.
+func checkAllowed(line int, path string, what string, value string, allowed []string) []error {
+	if value == "" {
+		return nil
+	}
+
+	for _, a := range allowed {
+		if a == value {
+			return nil
+		}
+	}
+
+	return []error{fmt.Errorf("line %d: unknown %s \"%s\" in \"%s\", must be one of: %s", line, what, value, path, strings.Join(allowed, ", "))}
+}
+
+// Reports every key of the mapping node which doesn't match the yaml tag of a field in the given struct type.
+func unknownKeys(node *yaml.Node, t reflect.Type, path string) []error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var problems []error
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, ok := yamlField(t, key.Value)
+
+		if !ok {
+			problems = append(problems, fmt.Errorf("line %d: unknown key \"%s\" in \"%s\"", key.Line, key.Value, path))
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			problems = append(problems, unknownKeys(value, field.Type, path+"."+key.Value)...)
+		}
+	}
+
+	return problems
+}
+
+// Finds the struct field which is decoded from the given yaml key.
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		if name == key {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
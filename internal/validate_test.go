@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	cfg := `
+global:
+  environment:
+    FOO: "foo"
+  events:
+    before_each_task: ["echo 'before'"]
+
+build:
+  run:
+    - "go build"
+`
+
+	require.Empty(t, ValidateConfig(cfg))
+}
+
+func TestValidateConfigUnknownKeys(t *testing.T) {
+	cfg := `
+global:
+  env:
+    FOO: "foo"
+  events:
+    before_each_tusk: ["echo 'before'"]
+
+build:
+  flies: [main.go]
+  run:
+    - "go build"
+`
+
+	problems := ValidateConfig(cfg)
+
+	require.Len(t, problems, 3)
+	require.Equal(t, `line 3: unknown key "env" in "global"`, problems[0].Error())
+	require.Equal(t, `line 6: unknown key "before_each_tusk" in "global.events"`, problems[1].Error())
+	require.Equal(t, `line 9: unknown key "flies" in "build"`, problems[2].Error())
+}
+
+func TestValidateConfigTaskWithoutCommands(t *testing.T) {
+	problems := ValidateConfig("build:\n  files: [main.go]\n")
+
+	require.Len(t, problems, 1)
+	require.Equal(t, `line 1: task "build" has no commands to run`, problems[0].Error())
+}
+
+func TestValidateConfigTaskShadowedBySubcommand(t *testing.T) {
+	problems := ValidateConfig("clean:\n  run: [\"rm -rf dist\"]\n\nhelp:\n  run: [\"cat README.md\"]\n")
+
+	require.Len(t, problems, 2)
+	require.Equal(t, `line 1: task "clean" is shadowed by the "goke clean" command, rename it or run it with "goke run clean"`, problems[0].Error())
+	require.Equal(t, `line 4: task "help" is shadowed by the "goke help" command, rename it or run it with "goke run help"`, problems[1].Error())
+}
+
+func TestValidateConfigInvalidYaml(t *testing.T) {
+	require.Len(t, ValidateConfig("build: [\n"), 1)
+}
+
+func TestValidateConfigHookFailurePolicy(t *testing.T) {
+	cfg := `
+global:
+  events:
+    hook_failure: warn
+
+build:
+  events:
+    finally: ["docker rm -f build"]
+    hook_failure: explode
+  run:
+    - "go build"
+`
+
+	problems := ValidateConfig(cfg)
+
+	require.Len(t, problems, 1)
+	require.Equal(t, `line 6: unknown hook failure policy "explode" in "build", must be one of: fail, warn, ignore`, problems[0].Error())
+}
+
+func TestValidateConfigHookScopes(t *testing.T) {
+	cfg := `
+global:
+  events:
+    scope: everything
+
+build:
+  skip_hooks: [after_each_tusk]
+  events:
+    scope: top_level
+  run:
+    - "go build"
+`
+
+	problems := ValidateConfig(cfg)
+
+	require.Len(t, problems, 3)
+	require.Equal(t, `line 2: unknown hook scope "everything" in "global", must be one of: top_level, every_task, every_command`, problems[0].Error())
+	require.Contains(t, problems[1].Error(), `line 6: unknown hook "after_each_tusk" in "build"`)
+	require.Equal(t, `line 6: the hook scope can only be set in "global.events", not in "build"`, problems[2].Error())
+}